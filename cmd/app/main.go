@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/ygncode/real-debrid-downloader/internal/config"
 	"github.com/ygncode/real-debrid-downloader/internal/daemon"
 	"github.com/ygncode/real-debrid-downloader/internal/handlers"
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/opensubtitles"
 	"github.com/ygncode/real-debrid-downloader/internal/realdebrid"
 	"github.com/ygncode/real-debrid-downloader/internal/services"
 	"github.com/ygncode/real-debrid-downloader/internal/storage"
@@ -17,14 +21,39 @@ import (
 )
 
 var (
-	moviesPath     string
-	port           int
-	apiKey         string
-	subliminalPath string
-	password       string
-	daemonMode     bool
-	stopDaemon     bool
-	statusDaemon   bool
+	moviesPath      string
+	port            int
+	apiKey          string
+	subliminalPath  string
+	subProviders    []string
+	subLanguages    []string
+	osAPIKey        string
+	osUsername      string
+	osPassword      string
+	osURL           string
+	password        string
+	connections     int
+	maxConcurrent   int
+	pollInterval    int
+	retryMax        int
+	retryDelay      int
+	onCollision     string
+	selectAll       bool
+	selectExt       []string
+	selectMinSize   int
+	selectExclude   []string
+	selectNoSamples bool
+	selectLargest   bool
+	libraries       []string
+	routes          []string
+	scanInterval    int
+	trashDays       int
+	organize        bool
+	movieTemplate   string
+	episodeTemplate string
+	daemonMode      bool
+	stopDaemon      bool
+	statusDaemon    bool
 )
 
 func main() {
@@ -40,7 +69,39 @@ and allows downloading new movies via Real-Debrid API with automatic subtitle fe
 	rootCmd.Flags().IntVar(&port, "port", 8080, "Port to run the web server on")
 	rootCmd.Flags().StringVar(&apiKey, "api-key", "", "Real-Debrid API key (or set REALDEBRID_API_KEY env var)")
 	rootCmd.Flags().StringVar(&subliminalPath, "subliminal-path", "", "Path to subliminal binary (e.g., /home/user/miniconda3/bin/subliminal)")
+	rootCmd.Flags().StringSliceVar(&subProviders, "subtitle-providers", []string{"opensubtitles", "subliminal"}, "Subtitle providers to try, in order")
+	rootCmd.Flags().StringSliceVar(&subLanguages, "subtitle-languages", []string{"en"}, "Subtitle languages to download, in order, as ISO 639-1 codes (e.g. en,es,my)")
+	rootCmd.Flags().StringVar(&osAPIKey, "opensubtitles-key", "", "OpenSubtitles API key (or set OPENSUBTITLES_API_KEY env var)")
+	rootCmd.Flags().StringVar(&osUsername, "opensubtitles-user", "", "OpenSubtitles username, for a higher download quota (optional)")
+	rootCmd.Flags().StringVar(&osPassword, "opensubtitles-password", "", "OpenSubtitles password (or set OPENSUBTITLES_PASSWORD env var)")
+	rootCmd.Flags().StringVar(&osURL, "opensubtitles-url", opensubtitles.BaseURL, "OpenSubtitles API base URL")
 	rootCmd.Flags().StringVar(&password, "password", "", "Password to protect the web interface (optional)")
+	rootCmd.Flags().IntVar(&connections, "connections", 4, "Parallel connections per file download")
+	rootCmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 2, "Number of downloads to transfer at the same time")
+	rootCmd.Flags().IntVar(&pollInterval, "poll-interval", 5, "Seconds between Real-Debrid status checks")
+	rootCmd.Flags().IntVar(&retryMax, "retry-max", 3, "Automatic retries for downloads that fail with transient errors (0 to disable)")
+	rootCmd.Flags().IntVar(&retryDelay, "retry-delay", 30, "Seconds before the first automatic retry, doubled for each one after")
+	rootCmd.Flags().StringVar(&onCollision, "on-collision", config.CollisionSize, "What to do when a downloaded file already exists: skip, rename, overwrite or size")
+
+	// Automatic file selection rules
+	rootCmd.Flags().BoolVar(&selectAll, "select-all", false, "Download every file of a torrent without asking")
+	rootCmd.Flags().StringSliceVar(&selectExt, "select-ext", nil, "Only select files with these extensions (e.g. .mkv,.mp4,.srt)")
+	rootCmd.Flags().IntVar(&selectMinSize, "select-min-size", 0, "Skip video files smaller than this many MB")
+	rootCmd.Flags().StringArrayVar(&selectExclude, "select-exclude", nil, "Skip files whose path matches this regex (repeatable, e.g. extras)")
+	rootCmd.Flags().BoolVar(&selectNoSamples, "select-exclude-samples", false, "Skip sample clips, but not titles that contain the word")
+	rootCmd.Flags().BoolVar(&selectLargest, "select-largest", false, "Select only the largest video file, plus other matching files")
+
+	// Library roots and routing
+	rootCmd.Flags().StringArrayVar(&libraries, "library", nil, "Extra library as name=path, e.g. tv=/mnt/tv (repeatable; --path is the \"movies\" library)")
+	rootCmd.Flags().StringArrayVar(&routes, "route", nil, "Send matching downloads to a library: name:type=series, name:tag=docs or name:pattern=regex (repeatable)")
+
+	rootCmd.Flags().IntVar(&scanInterval, "scan-interval", 15, "Minutes between library rescans (0 to only scan at startup)")
+	rootCmd.Flags().IntVar(&trashDays, "trash-days", 30, "Days deleted files stay in the trash before they are purged (0 to keep them)")
+
+	// Library organizer
+	rootCmd.Flags().BoolVar(&organize, "organize", false, "Move finished downloads into Title (Year) and Show/Season folders")
+	rootCmd.Flags().StringVar(&movieTemplate, "movie-template", config.DefaultMovieTemplate, "Organizer naming template for movies, without extension")
+	rootCmd.Flags().StringVar(&episodeTemplate, "episode-template", config.DefaultEpisodeTemplate, "Organizer naming template for episodes, without extension")
 
 	// Daemon mode flags
 	rootCmd.Flags().BoolVarP(&daemonMode, "daemon", "d", false, "Run in background (daemon mode)")
@@ -118,6 +179,75 @@ func runServer(cmd *cobra.Command, args []string) {
 
 	// Initialize configuration
 	cfg := config.New(moviesPath, apiKey, port)
+	if connections > 0 {
+		cfg.Connections = connections
+	}
+	if maxConcurrent > 0 {
+		cfg.MaxConcurrent = maxConcurrent
+	}
+	if pollInterval > 0 {
+		cfg.PollInterval = pollInterval
+	}
+	if retryMax >= 0 {
+		cfg.RetryMax = retryMax
+	}
+	if retryDelay > 0 {
+		cfg.RetryDelay = retryDelay
+	}
+	if !config.ValidCollisionPolicy(onCollision) {
+		log.Fatalf("Invalid --on-collision value %q, expected skip, rename, overwrite or size", onCollision)
+	}
+	cfg.OnCollision = onCollision
+	cfg.Selection = models.SelectionRules{
+		All:            selectAll,
+		Extensions:     selectExt,
+		MinSize:        int64(selectMinSize) << 20,
+		Exclude:        selectExclude,
+		ExcludeSamples: selectNoSamples,
+		LargestOnly:    selectLargest,
+	}
+	if err := cfg.Selection.Validate(); err != nil {
+		log.Fatalf("Invalid --select-exclude pattern: %v", err)
+	}
+	if scanInterval >= 0 {
+		cfg.ScanInterval = scanInterval
+	}
+	if trashDays >= 0 {
+		cfg.TrashDays = trashDays
+	}
+	languages, err := config.ParseLanguages(subLanguages)
+	if err != nil {
+		log.Fatalf("Invalid --subtitle-languages value: %v", err)
+	}
+	if len(languages) > 0 {
+		cfg.SubtitleLanguages = languages
+	}
+	for _, spec := range libraries {
+		lib, err := config.ParseLibrary(spec)
+		if err != nil {
+			log.Fatalf("Invalid --library value: %v", err)
+		}
+		if cfg.HasLibrary(lib.Name) {
+			log.Fatalf("Library %q is defined more than once", lib.Name)
+		}
+		if info, err := os.Stat(lib.Path); err != nil || !info.IsDir() {
+			log.Fatalf("Library %s must be an existing directory: %s", lib.Name, lib.Path)
+		}
+		cfg.Libraries = append(cfg.Libraries, lib)
+	}
+	for _, spec := range routes {
+		route, err := config.ParseRoute(spec)
+		if err != nil {
+			log.Fatalf("Invalid --route value: %v", err)
+		}
+		if !cfg.HasLibrary(route.Library) {
+			log.Fatalf("Route %q refers to unknown library %q", spec, route.Library)
+		}
+		cfg.Routes = append(cfg.Routes, route)
+	}
+	cfg.Organize = organize
+	cfg.MovieTemplate = movieTemplate
+	cfg.EpisodeTemplate = episodeTemplate
 
 	// Initialize database
 	db, err := storage.NewDatabase(cfg.DBPath)
@@ -132,12 +262,23 @@ func runServer(cmd *cobra.Command, args []string) {
 	repo := storage.NewRepository(db)
 
 	// Initialize services
-	movieService := services.NewMovieService(cfg.MoviesPath)
-	subtitleService := services.NewSubtitleService(subliminalPath)
+	libraryService := services.NewLibraries(cfg.Libraries, cfg.Routes)
+	catalogService := services.NewCatalogService(repo, libraryService, time.Duration(cfg.ScanInterval)*time.Minute)
+	catalogService.Start()
+	defer catalogService.Stop()
+	trashService := services.NewTrashService(libraryService, catalogService, time.Duration(cfg.TrashDays)*24*time.Hour)
+	trashService.Start()
+	defer trashService.Stop()
+	movieService := services.NewMovieService(libraryService, catalogService, trashService)
+	subtitleService := services.NewSubtitleService(subtitleProviders()...)
 	downloadService := services.NewDownloadService(repo, rdClient, cfg.MoviesPath, subtitleService)
+	organizerService, err := services.NewOrganizerService(cfg.MovieTemplate, cfg.EpisodeTemplate)
+	if err != nil {
+		log.Fatalf("Failed to initialize organizer: %v", err)
+	}
 
 	// Initialize worker manager
-	workerManager := worker.NewManager(downloadService, rdClient, repo, cfg.MoviesPath, subtitleService)
+	workerManager := worker.NewManager(downloadService, rdClient, repo, subtitleService, organizerService, libraryService, catalogService, cfg)
 	workerManager.Start()
 	defer workerManager.Stop()
 
@@ -145,10 +286,12 @@ func runServer(cmd *cobra.Command, args []string) {
 	workerManager.ResumePendingDownloads()
 
 	// Initialize and start HTTP server
-	server := handlers.NewServer(cfg, movieService, downloadService, repo, workerManager, web.TemplatesFS, web.StaticFS, password)
+	server := handlers.NewServer(cfg, movieService, trashService, downloadService, repo, workerManager, web.TemplatesFS, web.StaticFS, password)
 
 	log.Printf("Starting RD Downloader server on port %d", cfg.Port)
-	log.Printf("Movies directory: %s", cfg.MoviesPath)
+	for _, lib := range cfg.Libraries {
+		log.Printf("Library %s: %s", lib.Name, lib.Path)
+	}
 	if password != "" {
 		log.Println("Password protection: enabled")
 	}
@@ -157,3 +300,32 @@ func runServer(cmd *cobra.Command, args []string) {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// subtitleProviders builds the providers named by --subtitle-providers, in
+// order
+func subtitleProviders() []services.SubtitleProvider {
+	if osAPIKey == "" {
+		osAPIKey = os.Getenv("OPENSUBTITLES_API_KEY")
+	}
+	if osPassword == "" {
+		osPassword = os.Getenv("OPENSUBTITLES_PASSWORD")
+	}
+
+	var providers []services.SubtitleProvider
+	for _, name := range subProviders {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "opensubtitles":
+			if osAPIKey == "" {
+				log.Println("No OpenSubtitles API key, set --opensubtitles-key to use OpenSubtitles for subtitles")
+				continue
+			}
+			client := opensubtitles.NewClient(osURL, osAPIKey, osUsername, osPassword)
+			providers = append(providers, services.NewOpenSubtitlesProvider(client))
+		case "subliminal":
+			providers = append(providers, services.NewSubliminalProvider(subliminalPath))
+		default:
+			log.Fatalf("Unknown subtitle provider %q, expected opensubtitles or subliminal", name)
+		}
+	}
+	return providers
+}
@@ -1,10 +1,33 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// Collision policies for downloaded files whose name is already taken
+const (
+	CollisionSkip      = "skip"      // Keep the existing file and skip the download
+	CollisionRename    = "rename"    // Download under a new name with a numbered suffix
+	CollisionOverwrite = "overwrite" // Replace the existing file
+	CollisionSize      = "size"      // Skip if the sizes match, otherwise rename
 )
 
+// Default organizer naming templates. The file extension is added to the
+// rendered name, and slashes separate folders.
+const (
+	DefaultMovieTemplate   = `{{.Title}}{{if .Year}} ({{.Year}}){{end}}/{{.Title}}{{if .Year}} ({{.Year}}){{end}}{{if .Resolution}} - {{.Resolution}}{{end}}`
+	DefaultEpisodeTemplate = `{{.Title}}/Season {{printf "%02d" .Season}}/{{.Title}} - {{.EpisodeLabel}}`
+)
+
+// DefaultLibrary names the library given by --path
+const DefaultLibrary = "movies"
+
 type Config struct {
 	MoviesPath    string
 	APIKey        string
@@ -12,6 +35,21 @@ type Config struct {
 	DBPath        string
 	MaxConcurrent int
 	PollInterval  int // seconds
+	Connections   int // Parallel connections per file
+	RetryMax      int // Automatic retries for transient failures
+	RetryDelay    int // seconds before the first automatic retry
+	OnCollision   string
+	Selection     models.SelectionRules // Default rules for picking torrent files
+	Libraries     []models.Library      // Named download roots, the default one first
+	Routes        []models.RouteRule    // Rules picking a library for each download
+	ScanInterval  int                   // minutes between library rescans, 0 for startup only
+	TrashDays     int                   // days deleted items stay in the trash, 0 to keep them
+
+	SubtitleLanguages []string // Languages to fetch subtitles in, as ISO 639-1 codes
+
+	Organize        bool   // Move finished downloads into a clean layout
+	MovieTemplate   string // Organizer naming template for movies
+	EpisodeTemplate string // Organizer naming template for episodes
 }
 
 func New(moviesPath, apiKey string, port int) *Config {
@@ -26,5 +64,95 @@ func New(moviesPath, apiKey string, port int) *Config {
 		DBPath:        filepath.Join(dbDir, "rd-downloader.db"),
 		MaxConcurrent: 2,
 		PollInterval:  5,
+		Connections:   4,
+		RetryMax:      3,
+		RetryDelay:    30,
+		OnCollision:   CollisionSize,
+		Libraries:     []models.Library{{Name: DefaultLibrary, Path: moviesPath}},
+		ScanInterval:  15,
+		TrashDays:     30,
+
+		SubtitleLanguages: []string{"en"},
+
+		MovieTemplate:   DefaultMovieTemplate,
+		EpisodeTemplate: DefaultEpisodeTemplate,
+	}
+}
+
+// ValidCollisionPolicy reports whether p is a known collision policy
+func ValidCollisionPolicy(p string) bool {
+	switch p {
+	case CollisionSkip, CollisionRename, CollisionOverwrite, CollisionSize:
+		return true
+	}
+	return false
+}
+
+// HasLibrary reports whether a library with this name is configured
+func (c *Config) HasLibrary(name string) bool {
+	for _, lib := range c.Libraries {
+		if lib.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLibrary reads a library given as name=path
+func ParseLibrary(s string) (models.Library, error) {
+	name, path, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || path == "" {
+		return models.Library{}, fmt.Errorf("expected name=path, got %q", s)
+	}
+	return models.Library{Name: name, Path: path}, nil
+}
+
+// ParseRoute reads a routing rule given as library:type=movie|series,
+// library:tag=name or library:pattern=regex
+func ParseRoute(s string) (models.RouteRule, error) {
+	library, cond, ok := strings.Cut(s, ":")
+	key, value, hasValue := strings.Cut(cond, "=")
+	if !ok || !hasValue || library == "" || value == "" {
+		return models.RouteRule{}, fmt.Errorf("expected library:condition=value, got %q", s)
+	}
+
+	rule := models.RouteRule{Library: library}
+	switch key {
+	case "type":
+		rule.Type = value
+	case "tag":
+		rule.Tag = value
+	case "pattern":
+		rule.Pattern = value
+	default:
+		return models.RouteRule{}, fmt.Errorf("unknown route condition %q, expected type, tag or pattern", key)
+	}
+	return rule, rule.Validate()
+}
+
+// languageRe matches ISO 639 codes, with an optional region or script as
+// in pt-br or zh-tw
+var languageRe = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,4})?$`)
+
+// ParseLanguages reads subtitle language codes given as a list, each of
+// which may itself be comma separated. Codes are lowercased and duplicates
+// dropped, keeping the order.
+func ParseLanguages(values []string) ([]string, error) {
+	var languages []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, code := range strings.Split(value, ",") {
+			code = strings.ToLower(strings.TrimSpace(code))
+			if code == "" || seen[code] {
+				continue
+			}
+			if !languageRe.MatchString(code) {
+				return nil, fmt.Errorf("invalid language code %q, expected one like en or pt-br", code)
+			}
+			seen[code] = true
+			languages = append(languages, code)
+		}
 	}
+	return languages, nil
 }
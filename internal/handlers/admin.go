@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateWorkersRequest struct {
+	MaxWorkers   *int `json:"max_workers"`
+	PollInterval *int `json:"poll_interval"` // Seconds
+}
+
+func (s *Server) handleGetWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, s.workerManager.Stats())
+}
+
+// handleUpdateWorkers changes the pool size and poll interval at runtime.
+// They are kept by the manager behind its own locks; the startup config is
+// shared with other requests and left as it was.
+func (s *Server) handleUpdateWorkers(c *gin.Context) {
+	var req UpdateWorkersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Check both settings before applying either, so a bad poll interval
+	// doesn't leave the pool resized
+	if req.MaxWorkers != nil && *req.MaxWorkers < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max workers must be at least 1"})
+		return
+	}
+	if req.PollInterval != nil && *req.PollInterval < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "poll interval must be at least 1 second"})
+		return
+	}
+
+	if req.MaxWorkers != nil {
+		if err := s.workerManager.SetMaxWorkers(*req.MaxWorkers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.PollInterval != nil {
+		if err := s.workerManager.SetPollInterval(time.Duration(*req.PollInterval) * time.Second); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, s.workerManager.Stats())
+}
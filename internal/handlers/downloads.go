@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/services"
 )
 
 func (s *Server) handleListDownloads(c *gin.Context) {
@@ -25,6 +26,19 @@ func (s *Server) handleListDownloads(c *gin.Context) {
 	})
 }
 
+func (s *Server) handleGetQueue(c *gin.Context) {
+	downloads, err := s.downloadService.GetQueuedDownloads()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if downloads == nil {
+		downloads = []models.Download{}
+	}
+	c.JSON(http.StatusOK, gin.H{"queue": downloads})
+}
+
 func (s *Server) handleGetDownloadFiles(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -85,6 +99,9 @@ func (s *Server) handleDeleteDownload(c *gin.Context) {
 		return
 	}
 
+	// Stop any worker still busy with it before the record goes away
+	s.workerManager.Cancel(uint(id))
+
 	if err := s.downloadService.DeleteDownload(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -93,6 +110,100 @@ func (s *Server) handleDeleteDownload(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+type MoveDownloadRequest struct {
+	To       string `json:"to"`       // "top", "bottom" or "position"
+	Position int    `json:"position"` // 1-based queue position when moving to a position
+}
+
+func (s *Server) handleMoveDownload(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+		return
+	}
+
+	var req MoveDownloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := s.downloadService.MoveDownload(uint(id), req.To, req.Position); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) handlePauseDownload(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.Pause)
+}
+
+func (s *Server) handleResumeDownload(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.Resume)
+}
+
+func (s *Server) handleCancelDownload(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.Cancel)
+}
+
+func (s *Server) handleRetryDownload(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.Retry)
+}
+
+func (s *Server) handleReaddDownload(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.Readd)
+}
+
+func (s *Server) handleRetryFailedFiles(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.RetryFailed)
+}
+
+func (s *Server) handleOrganizeDownload(c *gin.Context) {
+	s.controlDownload(c, s.workerManager.Organize)
+}
+
+// handlePreviewOrganize lists where Organize would move each file
+func (s *Server) handlePreviewOrganize(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+		return
+	}
+
+	moves, err := s.workerManager.PreviewOrganize(uint(id))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if moves == nil {
+		moves = []services.Move{}
+	}
+	c.JSON(http.StatusOK, gin.H{"moves": moves})
+}
+
+// controlDownload applies a control action to the download in the URL
+func (s *Server) controlDownload(c *gin.Context, action func(id uint) (*models.Download, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid download ID"})
+		return
+	}
+
+	download, err := action(uint(id))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"status":  download.Status,
+	})
+}
+
 func (s *Server) handleSSE(c *gin.Context) {
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -119,8 +230,13 @@ func (s *Server) handleSSE(c *gin.Context) {
 		select {
 		case <-clientGone:
 			return
-		case download := <-updates:
-			sendDownloadEvent(c, download)
+		case event := <-updates:
+			if event.Download != nil {
+				sendDownloadEvent(c, event.Download)
+			}
+			if event.RefreshMovies {
+				sendRefreshMovies(c)
+			}
 		case <-ticker.C:
 			// Send keepalive
 			fmt.Fprintf(c.Writer, ": keepalive\n\n")
@@ -136,9 +252,13 @@ func sendDownloadEvent(c *gin.Context, download *models.Download) {
 	c.Writer.Flush()
 
 	// If download is complete, send a refresh-movies event
-	if download.Status == models.StatusComplete {
-		fmt.Fprintf(c.Writer, "event: refresh-movies\n")
-		fmt.Fprintf(c.Writer, "data: {}\n\n")
-		c.Writer.Flush()
+	if download.Status == models.StatusComplete || download.Status == models.StatusPartial {
+		sendRefreshMovies(c)
 	}
 }
+
+func sendRefreshMovies(c *gin.Context) {
+	fmt.Fprintf(c.Writer, "event: refresh-movies\n")
+	fmt.Fprintf(c.Writer, "data: {}\n\n")
+	c.Writer.Flush()
+}
@@ -8,7 +8,9 @@ import (
 	"html/template"
 	"io/fs"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ygncode/real-debrid-downloader/internal/config"
@@ -20,6 +22,7 @@ import (
 type Server struct {
 	config          *config.Config
 	movieService    *services.MovieService
+	trashService    *services.TrashService
 	downloadService *services.DownloadService
 	repo            *storage.Repository
 	workerManager   *worker.Manager
@@ -32,6 +35,7 @@ type Server struct {
 func NewServer(
 	cfg *config.Config,
 	movieService *services.MovieService,
+	trashService *services.TrashService,
 	downloadService *services.DownloadService,
 	repo *storage.Repository,
 	workerManager *worker.Manager,
@@ -44,6 +48,7 @@ func NewServer(
 	s := &Server{
 		config:          cfg,
 		movieService:    movieService,
+		trashService:    trashService,
 		downloadService: downloadService,
 		repo:            repo,
 		workerManager:   workerManager,
@@ -63,6 +68,10 @@ func (s *Server) setupRoutes(templatesFS embed.FS, staticFS embed.FS) {
 		"formatProgress": func(p float64) string {
 			return fmt.Sprintf("%.1f", p)
 		},
+		"formatTime": func(t *time.Time) string {
+			return t.Local().Format("15:04")
+		},
+		"join": strings.Join,
 	}).ParseFS(templatesFS, "templates/*.html", "templates/**/*.html"))
 	s.router.SetHTMLTemplate(tmpl)
 
@@ -80,6 +89,7 @@ func (s *Server) setupRoutes(templatesFS embed.FS, staticFS embed.FS) {
 	protected.Use(s.authMiddleware())
 	{
 		protected.GET("/", s.handleIndex)
+		protected.GET("/player", s.handlePlayer)
 	}
 
 	api := s.router.Group("/api")
@@ -87,13 +97,36 @@ func (s *Server) setupRoutes(templatesFS embed.FS, staticFS embed.FS) {
 	{
 		api.GET("/movies", s.handleListMovies)
 		api.DELETE("/movies", s.handleDeleteFile)
+		api.POST("/movies/rename", s.handleRenameFile)
+		api.POST("/movies/move", s.handleMoveFile)
+		api.POST("/movies/folder", s.handleCreateFolder)
+		api.GET("/movies/stream", s.handleStreamMovie)
+		api.GET("/movies/archive", s.handleArchiveMovie)
+		api.GET("/movies/subtitles", s.handleMovieSubtitles)
+		api.GET("/libraries", s.handleListLibraries)
+		api.GET("/trash", s.handleListTrash)
+		api.POST("/trash/:id/restore", s.handleRestoreTrash)
+		api.DELETE("/trash/:id", s.handlePurgeTrash)
+		api.DELETE("/trash", s.handleEmptyTrash)
 		api.POST("/torrents/magnet", s.handleAddMagnet)
 		api.POST("/torrents/file", s.handleAddTorrentFile)
 		api.GET("/downloads", s.handleListDownloads)
+		api.GET("/downloads/queue", s.handleGetQueue)
 		api.GET("/downloads/:id/files", s.handleGetDownloadFiles)
 		api.POST("/downloads/:id/select", s.handleSelectFiles)
+		api.POST("/downloads/:id/move", s.handleMoveDownload)
+		api.POST("/downloads/:id/pause", s.handlePauseDownload)
+		api.POST("/downloads/:id/resume", s.handleResumeDownload)
+		api.POST("/downloads/:id/cancel", s.handleCancelDownload)
+		api.POST("/downloads/:id/retry", s.handleRetryDownload)
+		api.POST("/downloads/:id/retry-failed", s.handleRetryFailedFiles)
+		api.POST("/downloads/:id/readd", s.handleReaddDownload)
+		api.GET("/downloads/:id/organize/preview", s.handlePreviewOrganize)
+		api.POST("/downloads/:id/organize", s.handleOrganizeDownload)
 		api.DELETE("/downloads/:id", s.handleDeleteDownload)
 		api.GET("/downloads/stream", s.handleSSE)
+		api.GET("/admin/workers", s.handleGetWorkers)
+		api.PUT("/admin/workers", s.handleUpdateWorkers)
 	}
 }
 
@@ -1,17 +1,27 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ygncode/real-debrid-downloader/internal/models"
 )
 
 func (s *Server) handleIndex(c *gin.Context) {
-	movies, err := s.movieService.ListMovies()
+	libraries := s.movieService.Libraries()
+
+	movies, err := s.movieService.ListMovies("")
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "index.html", gin.H{
 			"error":      err.Error(),
 			"moviesPath": s.config.MoviesPath,
+			"libraries":  libraries,
 		})
 		return
 	}
@@ -19,28 +29,183 @@ func (s *Server) handleIndex(c *gin.Context) {
 	downloads, _ := s.downloadService.GetAllDownloads()
 
 	c.HTML(http.StatusOK, "index.html", gin.H{
-		"movies":     movies,
-		"downloads":  downloads,
-		"moviesPath": s.config.MoviesPath,
+		"movies":            movies,
+		"downloads":         downloads,
+		"moviesPath":        s.config.MoviesPath,
+		"libraries":         libraries,
+		"subtitleLanguages": strings.Join(s.config.SubtitleLanguages, ", "),
 	})
 }
 
+// Page sizes for GET /api/movies
+const (
+	defaultMoviesPageSize = 100 // For JSON without a limit
+	maxMoviesPageSize     = 1000
+)
+
+// handleListMovies lists the collection, filtered, sorted and paged by the
+// query parameters. It returns JSON with ?format=json or an Accept header
+// asking for it, and the HTML fragment otherwise.
 func (s *Server) handleListMovies(c *gin.Context) {
-	movies, err := s.movieService.ListMovies()
+	asJSON := c.Query("format") == "json" || strings.Contains(c.GetHeader("Accept"), "application/json")
+
+	q, err := parseMovieQuery(c)
+	if err != nil {
+		moviesError(c, asJSON, err)
+		return
+	}
+	if asJSON && q.Limit == 0 {
+		q.Limit = defaultMoviesPageSize
+	}
+
+	movies, next, err := s.movieService.QueryMovies(q)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "components/movie_list.html", gin.H{
-			"error": err.Error(),
+		moviesError(c, asJSON, err)
+		return
+	}
+
+	if asJSON {
+		if movies == nil {
+			movies = []models.Movie{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"movies":      movies,
+			"next_cursor": next,
 		})
 		return
 	}
 
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
 	c.HTML(http.StatusOK, "components/movie_list.html", gin.H{
-		"movies": movies,
+		"movies":    movies,
+		"libraries": s.movieService.Libraries(),
+	})
+}
+
+func moviesError(c *gin.Context, asJSON bool, err error) {
+	if asJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.HTML(http.StatusBadRequest, "components/movie_list.html", gin.H{
+		"error": err.Error(),
 	})
 }
 
+// parseMovieQuery reads the collection filters from the query string
+func parseMovieQuery(c *gin.Context) (models.MovieQuery, error) {
+	q := models.MovieQuery{
+		Library: c.Query("library"),
+		Search:  strings.TrimSpace(c.Query("q")),
+		Cursor:  c.Query("cursor"),
+	}
+
+	switch t := c.Query("type"); t {
+	case "", "video", "subtitle":
+		q.FileType = t
+	default:
+		return q, fmt.Errorf("type must be video or subtitle")
+	}
+
+	switch c.Query("kind") {
+	case "":
+	case "folder":
+		q.Folders = ptr(true)
+	case "file":
+		q.Folders = ptr(false)
+	default:
+		return q, fmt.Errorf("kind must be folder or file")
+	}
+
+	var err error
+	if q.MinSize, err = intParam(c, "min_size"); err != nil {
+		return q, err
+	}
+	if q.MaxSize, err = intParam(c, "max_size"); err != nil {
+		return q, err
+	}
+	if q.After, err = dateParam(c, "after", false); err != nil {
+		return q, err
+	}
+	if q.Before, err = dateParam(c, "before", true); err != nil {
+		return q, err
+	}
+	q.MissingSubtitles = c.Query("missing_subtitles") == "true" || c.Query("missing_subtitles") == "1"
+
+	q.Sort = c.DefaultQuery("sort", models.SortDate)
+	switch q.Sort {
+	case models.SortDate, models.SortSize:
+		q.Desc = true
+	case models.SortName:
+	default:
+		return q, fmt.Errorf("sort must be date, name or size")
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	limit, err := intParam(c, "limit")
+	if err != nil {
+		return q, err
+	}
+	q.Limit = int(min(limit, maxMoviesPageSize))
+
+	return q, nil
+}
+
+// intParam reads a non-negative integer query parameter, 0 when missing
+func intParam(c *gin.Context, name string) (int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number", name)
+	}
+	return n, nil
+}
+
+// dateParam reads a date (2006-01-02, local time) or RFC 3339 timestamp.
+// With endOfDay a plain date covers the whole day.
+func dateParam(c *gin.Context, name string, endOfDay bool) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date such as 2024-01-31", name)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// handleListLibraries returns the configured libraries
+func (s *Server) handleListLibraries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"libraries": s.movieService.Libraries()})
+}
+
 type DeleteFileRequest struct {
-	Path string `json:"path" binding:"required"`
+	Library string `json:"library"` // Defaults to the first library
+	Path    string `json:"path" binding:"required"`
 }
 
 func (s *Server) handleDeleteFile(c *gin.Context) {
@@ -50,10 +215,91 @@ func (s *Server) handleDeleteFile(c *gin.Context) {
 		return
 	}
 
-	if err := s.movieService.DeleteFile(req.Path); err != nil {
+	if err := s.movieService.DeleteFile(req.Library, req.Path); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	s.workerManager.RefreshMovies()
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
+
+type RenameFileRequest struct {
+	Library string `json:"library"`
+	Path    string `json:"path" binding:"required"`
+	Name    string `json:"name" binding:"required"`
+}
+
+func (s *Server) handleRenameFile(c *gin.Context) {
+	var req RenameFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path and name are required"})
+		return
+	}
+
+	path, err := s.movieService.Rename(req.Library, req.Path, req.Name)
+	if err != nil {
+		fileOpError(c, err)
+		return
+	}
+	s.workerManager.RefreshMovies()
+
+	c.JSON(http.StatusOK, gin.H{"path": path})
+}
+
+type MoveFileRequest struct {
+	Library string `json:"library"`
+	Path    string `json:"path" binding:"required"`
+	To      string `json:"to"` // Folder to move into, "" for the top of the library
+}
+
+func (s *Server) handleMoveFile(c *gin.Context) {
+	var req MoveFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path is required"})
+		return
+	}
+
+	path, err := s.movieService.Move(req.Library, req.Path, req.To)
+	if err != nil {
+		fileOpError(c, err)
+		return
+	}
+	s.workerManager.RefreshMovies()
+
+	c.JSON(http.StatusOK, gin.H{"path": path})
+}
+
+type CreateFolderRequest struct {
+	Library string `json:"library"`
+	Path    string `json:"path" binding:"required"`
+}
+
+func (s *Server) handleCreateFolder(c *gin.Context) {
+	var req CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path is required"})
+		return
+	}
+
+	path, err := s.movieService.CreateFolder(req.Library, req.Path)
+	if err != nil {
+		fileOpError(c, err)
+		return
+	}
+	s.workerManager.RefreshMovies()
+
+	c.JSON(http.StatusCreated, gin.H{"path": path})
+}
+
+// fileOpError reports a failed rename, move or folder creation
+func fileOpError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, fs.ErrExist):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
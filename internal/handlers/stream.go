@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ygncode/real-debrid-downloader/internal/webvtt"
+)
+
+// mediaTypes are the Content-Types of library files that Go's mime package
+// doesn't know, or gets wrong for browsers
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".wmv":  "video/x-ms-wmv",
+	".flv":  "video/x-flv",
+	".ts":   "video/mp2t",
+	".m2ts": "video/mp2t",
+	".srt":  "application/x-subrip",
+	".ass":  "text/x-ssa",
+	".ssa":  "text/x-ssa",
+	".vtt":  "text/vtt; charset=utf-8",
+	".nfo":  "text/plain; charset=utf-8",
+}
+
+// handleStreamMovie serves a library file, with Range requests so browsers
+// can seek in videos
+func (s *Server) handleStreamMovie(c *gin.Context) {
+	f, info, err := s.movieService.OpenFile(c.Query("library"), c.Query("path"))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	defer f.Close()
+
+	if t, ok := mediaTypes[strings.ToLower(path.Ext(info.Name()))]; ok {
+		c.Header("Content-Type", t)
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
+
+// handleArchiveMovie downloads an item of the collection: a file as it is,
+// or a folder as a ZIP archive built while it is sent
+func (s *Server) handleArchiveMovie(c *gin.Context) {
+	library, relativePath := c.Query("library"), c.Query("path")
+	info, err := s.movieService.Stat(library, relativePath)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	if !info.IsDir() {
+		f, info, err := s.movieService.OpenFile(library, relativePath)
+		if err != nil {
+			fileError(c, err)
+			return
+		}
+		defer f.Close()
+
+		c.Header("Content-Disposition", attachment(info.Name()))
+		if t, ok := mediaTypes[strings.ToLower(path.Ext(info.Name()))]; ok {
+			c.Header("Content-Type", t)
+		}
+		http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+		return
+	}
+
+	// The size isn't known up front, so the archive is sent chunked and
+	// can't be resumed
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", attachment(info.Name()+".zip"))
+	c.Status(http.StatusOK)
+	if err := s.movieService.WriteArchive(c.Writer, library, relativePath); err != nil {
+		// The status is already sent. Dropping the connection at least
+		// keeps the client from saving a truncated archive as complete.
+		log.Printf("Failed to archive %s: %v", relativePath, err)
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
+
+// attachment builds a Content-Disposition header that saves the response
+// as name. Names outside ASCII are encoded as RFC 2231 allows.
+func attachment(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
+
+// handleMovieSubtitles serves a subtitle file converted to WebVTT for the
+// player's text tracks
+func (s *Server) handleMovieSubtitles(c *gin.Context) {
+	ext := strings.ToLower(path.Ext(c.Query("path")))
+	if !webvtt.Supported(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .srt, .ass, .ssa and .vtt subtitles can be converted"})
+		return
+	}
+
+	f, _, err := s.movieService.OpenFile(c.Query("library"), c.Query("path"))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	defer f.Close()
+
+	c.Header("Content-Type", "text/vtt; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	if err := webvtt.Convert(c.Writer, f, ext); err != nil {
+		log.Printf("Failed to convert %s to WebVTT: %v", c.Query("path"), err)
+	}
+}
+
+// handlePlayer shows a page playing a video of the collection, or the
+// largest video of a folder, with its subtitles
+func (s *Server) handlePlayer(c *gin.Context) {
+	library := c.Query("library")
+	video, err := s.movieService.PlayableVideo(library, c.Query("path"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		c.HTML(status, "player.html", gin.H{"error": err.Error()})
+		return
+	}
+
+	tracks, err := s.movieService.SubtitleTracks(library, video)
+	if err != nil {
+		log.Printf("Failed to list subtitles for %s: %v", video, err)
+	}
+
+	c.HTML(http.StatusOK, "player.html", gin.H{
+		"library": library,
+		"video":   video,
+		"name":    path.Base(video),
+		"tracks":  tracks,
+	})
+}
+
+// fileError reports a file that could not be opened
+func fileError(c *gin.Context, err error) {
+	switch {
+	case c.Query("path") == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path is required"})
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
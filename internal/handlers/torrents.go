@@ -1,14 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ygncode/real-debrid-downloader/internal/config"
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/services"
 )
 
 type AddMagnetRequest struct {
-	Magnet       string `json:"magnet" binding:"required"`
-	DownloadSubs *bool  `json:"download_subs"` // Pointer to distinguish between false and not provided
+	Magnet            string                 `json:"magnet" binding:"required"`
+	DownloadSubs      *bool                  `json:"download_subs"`      // Pointer to distinguish between false and not provided
+	SubtitleLanguages []string               `json:"subtitle_languages"` // Overrides the configured subtitle languages
+	Selection         *models.SelectionRules `json:"selection"`          // Overrides the default file selection rules
+	Library           string                 `json:"library"`            // Destination library, routed automatically if empty
+	Tag               string                 `json:"tag"`                // Category tag for routing rules
 }
 
 func (s *Server) handleAddMagnet(c *gin.Context) {
@@ -24,7 +32,29 @@ func (s *Server) handleAddMagnet(c *gin.Context) {
 		downloadSubs = *req.DownloadSubs
 	}
 
-	download, err := s.downloadService.AddMagnet(c.Request.Context(), req.Magnet, downloadSubs)
+	languages, err := config.ParseLanguages(req.SubtitleLanguages)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subtitle languages: " + err.Error()})
+		return
+	}
+	if req.Selection != nil {
+		if err := req.Selection.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selection rules: " + err.Error()})
+			return
+		}
+	}
+	if req.Library != "" && !s.config.HasLibrary(req.Library) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown library: " + req.Library})
+		return
+	}
+
+	download, err := s.downloadService.AddMagnet(c.Request.Context(), req.Magnet, services.AddOptions{
+		DownloadSubs:      downloadSubs,
+		SubtitleLanguages: languages,
+		Selection:         req.Selection,
+		Library:           req.Library,
+		Tag:               req.Tag,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -54,7 +84,40 @@ func (s *Server) handleAddTorrentFile(c *gin.Context) {
 		downloadSubs = false
 	}
 
-	download, err := s.downloadService.AddTorrent(c.Request.Context(), header.Filename, file, downloadSubs)
+	// Subtitle languages arrive comma separated, as in "en,es"
+	languages, err := config.ParseLanguages(c.PostFormArray("subtitle_languages"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subtitle languages: " + err.Error()})
+		return
+	}
+
+	// Optional selection rules arrive as JSON in a form field
+	var selection *models.SelectionRules
+	if raw := c.PostForm("selection"); raw != "" {
+		selection = &models.SelectionRules{}
+		if err := json.Unmarshal([]byte(raw), selection); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selection rules"})
+			return
+		}
+		if err := selection.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selection rules: " + err.Error()})
+			return
+		}
+	}
+
+	library := c.PostForm("library")
+	if library != "" && !s.config.HasLibrary(library) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown library: " + library})
+		return
+	}
+
+	download, err := s.downloadService.AddTorrent(c.Request.Context(), header.Filename, file, services.AddOptions{
+		DownloadSubs:      downloadSubs,
+		SubtitleLanguages: languages,
+		Selection:         selection,
+		Library:           library,
+		Tag:               c.PostForm("tag"),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
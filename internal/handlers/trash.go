@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/services"
+)
+
+// handleListTrash lists deleted items, of one library with ?library=name.
+// It returns JSON with ?format=json or an Accept header asking for it, and
+// the HTML fragment otherwise.
+func (s *Server) handleListTrash(c *gin.Context) {
+	asJSON := c.Query("format") == "json" || strings.Contains(c.GetHeader("Accept"), "application/json")
+
+	library, ok := s.trashLibrary(c)
+	if !ok {
+		return
+	}
+	items, err := s.trashService.List(library)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if asJSON {
+		if items == nil {
+			items = []models.TrashItem{}
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items})
+		return
+	}
+	c.HTML(http.StatusOK, "components/trash_list.html", gin.H{
+		"items":         items,
+		"retentionDays": int(s.trashService.Retention().Hours() / 24),
+	})
+}
+
+func (s *Server) handleRestoreTrash(c *gin.Context) {
+	library, ok := s.trashLibrary(c)
+	if !ok {
+		return
+	}
+	item, err := s.trashService.Restore(library, c.Param("id"))
+	if err != nil {
+		trashError(c, http.StatusConflict, err)
+		return
+	}
+	s.workerManager.RefreshMovies()
+	c.JSON(http.StatusOK, item)
+}
+
+func (s *Server) handlePurgeTrash(c *gin.Context) {
+	library, ok := s.trashLibrary(c)
+	if !ok {
+		return
+	}
+	if err := s.trashService.Purge(library, c.Param("id")); err != nil {
+		trashError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// handleEmptyTrash purges the trash of one library, or of all of them
+func (s *Server) handleEmptyTrash(c *gin.Context) {
+	library, ok := s.trashLibrary(c)
+	if !ok {
+		return
+	}
+	purged, err := s.trashService.Empty(library)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "purged": purged})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// trashLibrary reads the library query parameter, rejecting unknown names
+func (s *Server) trashLibrary(c *gin.Context) (string, bool) {
+	library := c.Query("library")
+	if library != "" && !s.config.HasLibrary(library) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown library %q", library)})
+		return "", false
+	}
+	return library, true
+}
+
+func trashError(c *gin.Context, status int, err error) {
+	if errors.Is(err, services.ErrTrashItemNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
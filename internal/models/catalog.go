@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LibraryFile is a file seen on disk by the last library scan. Files are
+// compared by size and modification time to find what changed.
+type LibraryFile struct {
+	ID       uint      `gorm:"primaryKey" json:"id"`
+	Library  string    `gorm:"uniqueIndex:idx_library_file;index:idx_library_file_entry" json:"library"`
+	Path     string    `gorm:"uniqueIndex:idx_library_file" json:"path"`  // Relative to the library
+	Entry    string    `gorm:"index:idx_library_file_entry" json:"entry"` // Top level file or folder it belongs to
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	FileType string    `json:"file_type,omitempty"` // "video", "subtitle", "other", or "" for non-media files
+	Media    string    `json:"-"`                   // MediaInfo as JSON, for video files the probe understood
+	Probed   bool      `json:"-"`                   // Whether the probe has looked at this version of the file
+}
+
+// LibraryEntry is one item of the collection: a top level media file, or
+// a top level folder holding media files
+type LibraryEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Library   string    `gorm:"uniqueIndex:idx_library_entry" json:"library"`
+	Path      string    `gorm:"uniqueIndex:idx_library_entry" json:"path"`
+	Name      string    `json:"name"`
+	IsFolder  bool      `json:"is_folder"`
+	Size      int64     `json:"size"` // Total of all files for folders
+	ModTime   time.Time `gorm:"index" json:"mod_time"`
+	FileType  string    `json:"file_type,omitempty"`
+	Stem      string    `json:"-"`         // Name without extension for files, to match sibling subtitles
+	Videos    int       `json:"videos"`    // Video files in the entry
+	Subtitles int       `json:"subtitles"` // Subtitle files in the entry
+	Media     string    `json:"-"`         // MediaInfo of the largest video, as JSON
+}
+
+// Movie converts the entry to the form the collection lists
+func (e LibraryEntry) Movie() Movie {
+	return Movie{
+		Library:  e.Library,
+		Name:     e.Name,
+		Path:     e.Path,
+		Size:     e.Size,
+		ModTime:  e.ModTime,
+		IsFolder: e.IsFolder,
+		FileType: e.FileType,
+		Media:    e.MediaInfo(),
+	}
+}
+
+// MediaInfo decodes the cached probe results, nil when there are none
+func (e LibraryEntry) MediaInfo() *MediaInfo {
+	if e.Media == "" {
+		return nil
+	}
+	var info MediaInfo
+	if err := json.Unmarshal([]byte(e.Media), &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+// Sort orders for the collection
+const (
+	SortDate = "date"
+	SortName = "name"
+	SortSize = "size"
+)
+
+// MovieQuery filters, sorts and pages the collection. When it spans every
+// library, results are listed library by library.
+type MovieQuery struct {
+	Library          string     // "" for every library
+	Search           string     // Matched anywhere in the name, case-insensitive
+	FileType         string     // "video" or "subtitle": entries holding files of that type
+	Folders          *bool      // true for folders only, false for files only
+	MinSize          int64      // Bytes, 0 for no lower bound
+	MaxSize          int64      // Bytes, 0 for no upper bound
+	After            *time.Time // Modified at or after
+	Before           *time.Time // Modified before
+	MissingSubtitles bool       // Entries with videos but no subtitles
+	Sort             string     // SortDate, SortName or SortSize
+	Desc             bool
+	Limit            int    // Page size, 0 for everything
+	Cursor           string // From the previous page, "" for the first
+}
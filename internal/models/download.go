@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -14,6 +15,9 @@ const (
 	StatusSubtitles         DownloadStatus = "subtitles"
 	StatusComplete          DownloadStatus = "complete"
 	StatusError             DownloadStatus = "error"
+	StatusPaused            DownloadStatus = "paused"
+	StatusCancelled         DownloadStatus = "cancelled"
+	StatusPartial           DownloadStatus = "partial" // Finished with some files failed
 )
 
 type Download struct {
@@ -27,14 +31,57 @@ type Download struct {
 	FilesJSON       string         `json:"files_json,omitempty"`   // JSON array of torrent files for selection
 	SelectedIDs     string         `json:"selected_ids,omitempty"` // Comma-separated selected file IDs
 	FilePaths       string         `json:"file_paths,omitempty"`   // JSON array of downloaded file paths
+	FileResults     string         `json:"file_results,omitempty"` // JSON array of per-file outcomes
 	TotalSize       int64          `json:"total_size"`             // Total size in bytes
 	Downloaded      int64          `json:"downloaded"`             // Downloaded bytes
 	DownloadSubs    bool           `gorm:"default:true" json:"download_subs"` // Whether to download subtitles
-	SubtitleStatus  string         `json:"subtitle_status,omitempty"`         // Status of subtitle download
+	SubtitleLangs   string         `json:"subtitle_languages,omitempty"`      // Comma-separated subtitle languages, the configured ones if empty
+	SubtitleStatus  string         `json:"subtitle_status,omitempty"`         // Result of the subtitle download for each video and language
+	Priority        int            `gorm:"default:0" json:"priority"`         // Higher priority jobs are claimed first
+	RetryCount      int            `gorm:"default:0" json:"retry_count"`      // Automatic retries used so far
+	NextRetryAt     *time.Time     `json:"next_retry_at,omitempty"`           // When the next automatic retry is due
+	Magnet          string         `json:"magnet,omitempty"`                  // Original magnet link, if added from one
+	TorrentFilename string         `json:"torrent_filename,omitempty"`        // Original .torrent file name, if uploaded
+	TorrentData     []byte         `json:"-"`                                 // Original .torrent file contents
+	SelectionRules  string         `json:"selection_rules,omitempty"`         // JSON rules overriding the default file selection
+	Library         string         `json:"library,omitempty"`                 // Library the files go into, routed when the download starts if empty
+	Tag             string         `json:"tag,omitempty"`                     // Category tag that routing rules can match
+	QueuePosition   int            `gorm:"-" json:"queue_position,omitempty"` // Place in the job queue, 0 when not waiting
+	Release         *ReleaseInfo   `gorm:"-" json:"release,omitempty"`        // Parsed from the name
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 }
 
+// HasSource reports whether the torrent can be added to Real-Debrid again
+func (d Download) HasSource() bool {
+	return d.Magnet != "" || len(d.TorrentData) > 0
+}
+
+// SubtitleLanguages returns the languages chosen for this download, or nil
+// to use the configured ones
+func (d Download) SubtitleLanguages() []string {
+	if d.SubtitleLangs == "" {
+		return nil
+	}
+	return strings.Split(d.SubtitleLangs, ",")
+}
+
+// File result statuses
+const (
+	FileResultOK      = "ok"
+	FileResultFailed  = "failed"
+	FileResultSkipped = "skipped" // An existing file with the same name was kept
+)
+
+// FileResult records the outcome of downloading one link of a torrent
+type FileResult struct {
+	Link   string `json:"link"`
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
 type TorrentFile struct {
 	ID       int    `json:"id"`
 	Path     string `json:"path"`
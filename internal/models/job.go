@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Job is a queued piece of work for a download. Workers claim jobs by
+// taking a lease and keep it alive with heartbeats, so a job held by a
+// worker that died is picked up again once its lease expires.
+type Job struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	DownloadID     uint       `gorm:"uniqueIndex" json:"download_id"`
+	LeaseOwner     string     `json:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time `gorm:"index" json:"lease_expires_at,omitempty"`
+	HeartbeatAt    *time.Time `json:"heartbeat_at,omitempty"`
+	Attempts       int        `json:"attempts"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Library is a named folder that downloads are written to, such as a
+// Movies or TV share
+type Library struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Content types a routing rule can match
+const (
+	ContentMovie  = "movie"
+	ContentSeries = "series"
+)
+
+// RouteRule sends the downloads it matches to a library. Every condition
+// that is set must match; rules are tried in order and the first match wins.
+type RouteRule struct {
+	Library string `json:"library"`
+	Type    string `json:"type,omitempty"`    // movie or series, from the parsed release name
+	Tag     string `json:"tag,omitempty"`     // Category tag given when adding the download, case-insensitive
+	Pattern string `json:"pattern,omitempty"` // Regex matched against the download name, case-insensitive
+}
+
+// Validate checks that the rule has a condition and a valid pattern
+func (r RouteRule) Validate() error {
+	if r.Library == "" {
+		return fmt.Errorf("route has no library")
+	}
+	if r.Type == "" && r.Tag == "" && r.Pattern == "" {
+		return fmt.Errorf("route to %s has no condition", r.Library)
+	}
+	if r.Type != "" && !slices.Contains([]string{ContentMovie, ContentSeries}, r.Type) {
+		return fmt.Errorf("unknown content type %q, expected movie or series", r.Type)
+	}
+	if r.Pattern != "" {
+		if _, err := regexp.Compile("(?i)" + r.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match reports whether a download with this name, tag and parsed release
+// belongs in the rule's library
+func (r RouteRule) Match(name, tag string, info ReleaseInfo) bool {
+	if r.Type != "" && (r.Type == ContentSeries) != info.IsSeries() {
+		return false
+	}
+	if r.Tag != "" && !strings.EqualFold(r.Tag, tag) {
+		return false
+	}
+	if r.Pattern != "" {
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil || !re.MatchString(name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+)
+
+// MediaInfo describes the streams of a video file, read from its container
+type MediaInfo struct {
+	Duration   float64      `json:"duration,omitempty"` // Seconds
+	Width      int          `json:"width,omitempty"`
+	Height     int          `json:"height,omitempty"`
+	VideoCodec string       `json:"video_codec,omitempty"`
+	Audio      []MediaTrack `json:"audio,omitempty"`
+	Subtitles  []MediaTrack `json:"subtitles,omitempty"`
+}
+
+// MediaTrack is an audio or subtitle track
+type MediaTrack struct {
+	Codec    string `json:"codec,omitempty"`
+	Language string `json:"language,omitempty"` // ISO 639-2 code such as "eng", "" when unknown
+	Name     string `json:"name,omitempty"`
+	Channels int    `json:"channels,omitempty"` // Audio only
+	Default  bool   `json:"default,omitempty"`
+	Forced   bool   `json:"forced,omitempty"`
+}
+
+// Resolution formats the frame size as 1920×1080
+func (m MediaInfo) Resolution() string {
+	if m.Width == 0 || m.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d×%d", m.Width, m.Height)
+}
+
+// Runtime formats the duration as 1h 52m, or 42m
+func (m MediaInfo) Runtime() string {
+	minutes := int(m.Duration+30) / 60
+	switch {
+	case m.Duration <= 0:
+		return ""
+	case minutes < 60:
+		return fmt.Sprintf("%dm", max(minutes, 1))
+	default:
+		return fmt.Sprintf("%dh %02dm", minutes/60, minutes%60)
+	}
+}
+
+// AudioLanguages lists the languages of the audio tracks, once each
+func (m MediaInfo) AudioLanguages() []string {
+	return trackLanguages(m.Audio)
+}
+
+// SubtitleLanguages lists the languages of the subtitle tracks, once each
+func (m MediaInfo) SubtitleLanguages() []string {
+	return trackLanguages(m.Subtitles)
+}
+
+func trackLanguages(tracks []MediaTrack) []string {
+	var langs []string
+	for _, t := range tracks {
+		lang := t.Language
+		if lang == "" {
+			lang = "und"
+		}
+		if !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
@@ -3,10 +3,20 @@ package models
 import "time"
 
 type Movie struct {
-	Name     string    `json:"name"`
-	Path     string    `json:"path"`
-	Size     int64     `json:"size"`
-	ModTime  time.Time `json:"mod_time"`
-	IsFolder bool      `json:"is_folder"`
-	FileType string    `json:"file_type,omitempty"` // "video", "subtitle", "other"
+	Library  string       `json:"library"` // Library the file is in
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Size     int64        `json:"size"`
+	ModTime  time.Time    `json:"mod_time"`
+	IsFolder bool         `json:"is_folder"`
+	FileType string       `json:"file_type,omitempty"` // "video", "subtitle", "other"
+	Release  *ReleaseInfo `json:"release,omitempty"`   // Parsed from the name
+	Media    *MediaInfo   `json:"media,omitempty"`     // Read from the video's headers
+}
+
+// SubtitleTrack is a subtitle file next to a video, offered by the player
+type SubtitleTrack struct {
+	Path     string `json:"path"`               // Relative to the library
+	Label    string `json:"label"`              // Shown in the player's track menu
+	Language string `json:"language,omitempty"` // From a suffix such as Movie.en.srt
 }
@@ -0,0 +1,49 @@
+package models
+
+// SubtitleSearchResponse is a page of OpenSubtitles search results
+type SubtitleSearchResponse struct {
+	TotalPages int              `json:"total_pages"`
+	TotalCount int              `json:"total_count"`
+	Page       int              `json:"page"`
+	Data       []SubtitleResult `json:"data"`
+}
+
+// SubtitleResult is one subtitle found on OpenSubtitles
+type SubtitleResult struct {
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	Attributes SubtitleAttributes `json:"attributes"`
+}
+
+// SubtitleAttributes describes a subtitle found on OpenSubtitles
+type SubtitleAttributes struct {
+	Language        string         `json:"language"`
+	DownloadCount   int            `json:"download_count"`
+	HearingImpaired bool           `json:"hearing_impaired"`
+	MachineMade     bool           `json:"machine_translated"`
+	Release         string         `json:"release"`
+	MovieHashMatch  bool           `json:"moviehash_match"`
+	Files           []SubtitleFile `json:"files"`
+}
+
+// SubtitleFile is a downloadable file of a subtitle
+type SubtitleFile struct {
+	FileID   int    `json:"file_id"`
+	FileName string `json:"file_name"`
+}
+
+// SubtitleDownload is returned when requesting a subtitle file. The link is
+// only valid for a short while.
+type SubtitleDownload struct {
+	Link      string `json:"link"`
+	FileName  string `json:"file_name"`
+	Requests  int    `json:"requests"`
+	Remaining int    `json:"remaining"`
+	Message   string `json:"message"`
+}
+
+// SubtitleLogin is returned when logging in to OpenSubtitles
+type SubtitleLogin struct {
+	Token   string `json:"token"`
+	BaseURL string `json:"base_url"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "fmt"
+
+// ReleaseInfo is what can be read from a scene-style release name such as
+// Movie.Name.2021.2160p.UHD.BluRay.x265.HDR.DTS-HD.MA-GROUP
+type ReleaseInfo struct {
+	Title         string   `json:"title"`
+	Year          int      `json:"year,omitempty"`
+	Seasons       []int    `json:"seasons,omitempty"`
+	Episodes      []int    `json:"episodes,omitempty"`
+	Resolution    string   `json:"resolution,omitempty"`     // 2160p, 1080p, 720p, ...
+	Source        string   `json:"source,omitempty"`         // BluRay, WEB-DL, HDTV, ...
+	VideoCodec    string   `json:"video_codec,omitempty"`    // H.265, H.264, AV1, ...
+	AudioCodec    string   `json:"audio_codec,omitempty"`    // DTS-HD MA, TrueHD, DD+, ...
+	AudioChannels string   `json:"audio_channels,omitempty"` // 5.1, 7.1, ...
+	Atmos         bool     `json:"atmos,omitempty"`
+	HDR           []string `json:"hdr,omitempty"` // DV, HDR10+, HDR10, HDR, HLG
+	Group         string   `json:"group,omitempty"`
+	Proper        bool     `json:"proper,omitempty"`
+	Repack        bool     `json:"repack,omitempty"`
+}
+
+// IsSeries reports whether the release is TV rather than a movie
+func (r ReleaseInfo) IsSeries() bool {
+	return len(r.Seasons) > 0 || len(r.Episodes) > 0
+}
+
+// EpisodeLabel formats the seasons and episodes as S01E02, S01E01-E05 or
+// S01-S03, or returns "" for movies
+func (r ReleaseInfo) EpisodeLabel() string {
+	var label string
+	switch len(r.Seasons) {
+	case 0:
+	case 1:
+		label = fmt.Sprintf("S%02d", r.Seasons[0])
+	default:
+		label = fmt.Sprintf("S%02d-S%02d", r.Seasons[0], r.Seasons[len(r.Seasons)-1])
+	}
+
+	switch len(r.Episodes) {
+	case 0:
+	case 1:
+		label += fmt.Sprintf("E%02d", r.Episodes[0])
+	default:
+		label += fmt.Sprintf("E%02d-E%02d", r.Episodes[0], r.Episodes[len(r.Episodes)-1])
+	}
+	return label
+}
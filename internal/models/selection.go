@@ -0,0 +1,138 @@
+package models
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Extensions that selection rules treat as the main content of a torrent
+var selectionVideoExtensions = map[string]bool{
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".wmv": true,
+	".flv": true, ".webm": true, ".m4v": true, ".ts": true, ".m2ts": true,
+}
+
+// SelectionRules pick the files of a torrent to download without asking.
+// Filters apply in order: extensions, excludes and samples, then the
+// minimum size, which only applies to video files so subtitles are kept.
+// LargestOnly then keeps the biggest remaining video alongside the other
+// matches.
+type SelectionRules struct {
+	All            bool     `json:"all,omitempty"`             // Select every file
+	Extensions     []string `json:"extensions,omitempty"`      // Allowed extensions such as ".mkv"
+	MinSize        int64    `json:"min_size,omitempty"`        // Minimum video size in bytes
+	Exclude        []string `json:"exclude,omitempty"`         // Regexes matched against the file path, case-insensitive
+	ExcludeSamples bool     `json:"exclude_samples,omitempty"` // Skip sample clips, as IsSample finds them
+	LargestOnly    bool     `json:"largest_only,omitempty"`    // Keep only the largest video
+	Manual         bool     `json:"manual,omitempty"`          // Always ask, ignoring the default rules
+}
+
+// IsEmpty reports whether the rules select nothing on their own, in which
+// case files are chosen by hand
+func (r SelectionRules) IsEmpty() bool {
+	return r.Manual || (!r.All && len(r.Extensions) == 0 && r.MinSize == 0 && len(r.Exclude) == 0 && !r.ExcludeSamples && !r.LargestOnly)
+}
+
+// Validate checks that the exclude patterns compile
+func (r SelectionRules) Validate() error {
+	_, err := r.excludes()
+	return err
+}
+
+// Match returns the IDs of the files the rules select, or nil when no
+// video is left, unless All is set
+func (r SelectionRules) Match(files []TorrentFile) []int {
+	if r.IsEmpty() {
+		return nil
+	}
+
+	var ids []int
+	if r.All {
+		for _, f := range files {
+			ids = append(ids, f.ID)
+		}
+		return ids
+	}
+
+	excludes, err := r.excludes()
+	if err != nil {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(r.Extensions))
+	for _, ext := range r.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		allowed[ext] = true
+	}
+
+	var matched []TorrentFile
+	largest := -1
+	for _, f := range files {
+		ext := strings.ToLower(path.Ext(f.Path))
+		if len(allowed) > 0 && !allowed[ext] {
+			continue
+		}
+		if matchesAny(excludes, f.Path) || (r.ExcludeSamples && IsSample(f.Path)) {
+			continue
+		}
+
+		video := selectionVideoExtensions[ext]
+		if video && f.Bytes < r.MinSize {
+			continue
+		}
+
+		if video && (largest < 0 || f.Bytes > matched[largest].Bytes) {
+			largest = len(matched)
+		}
+		matched = append(matched, f)
+	}
+
+	// Subtitles and extras alone aren't worth downloading, so a torrent whose
+	// videos were all filtered out is left for manual selection
+	if largest < 0 {
+		return nil
+	}
+
+	for i, f := range matched {
+		if r.LargestOnly && i != largest && selectionVideoExtensions[strings.ToLower(path.Ext(f.Path))] {
+			continue
+		}
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func (r SelectionRules) excludes() ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range r.Exclude {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleRe matches the sample clips releases ship with: a Sample folder, or
+// a file named sample.mkv, sample-movie.mkv or movie-sample.mkv. Titles
+// that merely contain the word, such as The.Sample.Man.2020.mkv, don't match.
+var sampleRe = regexp.MustCompile(`(?i)(^|/)sample(/|[._ -])|[._ -]sample\.\w+$`)
+
+// IsSample reports whether a path within a release, such as
+// Movie/Sample/movie.mkv, is a sample clip
+func IsSample(path string) bool {
+	return sampleRe.MatchString(strings.ReplaceAll(path, `\`, "/"))
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSample(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"sample.mkv", true},
+		{"Sample.mkv", true},
+		{"sample-movie.2020.1080p.mkv", true},
+		{"movie.2020.1080p-sample.mkv", true},
+		{"Movie.2020.1080p.Sample.mkv", true},
+		{"movie_sample.mp4", true},
+		{"Movie.2020.1080p/Sample/movie.mkv", true},
+		{`Movie.2020.1080p\Sample\movie.mkv`, true},
+		{"The.Sample.Man.2020.1080p.mkv", false},
+		{"The Sample Man (2020).mkv", false},
+		{"Free.Samples.2012.720p.mkv", false},
+		{"Free Samples/Free.Samples.2012.720p.mkv", false},
+		{"Samplers.2019.mkv", false},
+		{"Movie.2020.1080p.mkv", false},
+	}
+	for _, tt := range tests {
+		if got := IsSample(tt.path); got != tt.want {
+			t.Errorf("IsSample(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchExcludeSamples(t *testing.T) {
+	files := []TorrentFile{
+		{ID: 1, Path: "/The.Sample.Man.2020.1080p/The.Sample.Man.2020.1080p.mkv", Bytes: 4 << 30},
+		{ID: 2, Path: "/The.Sample.Man.2020.1080p/Sample/the.sample.man.sample.mkv", Bytes: 50 << 20},
+		{ID: 3, Path: "/The.Sample.Man.2020.1080p/The.Sample.Man.2020.1080p.srt", Bytes: 80 << 10},
+	}
+
+	tests := []struct {
+		name  string
+		rules SelectionRules
+		want  []int
+	}{
+		{"samples only", SelectionRules{ExcludeSamples: true}, []int{1, 3}},
+		{"with largest", SelectionRules{ExcludeSamples: true, LargestOnly: true}, []int{1, 3}},
+		{"sample left alone", SelectionRules{Extensions: []string{".mkv"}}, []int{1, 2}},
+		{"only a sample", SelectionRules{ExcludeSamples: true, Extensions: []string{"mkv"}, MinSize: 5 << 30}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.Match(files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TrashDir is the folder inside each library that holds deleted items.
+// Library scans skip it.
+const TrashDir = ".trash"
+
+// TrashItem is a deleted file or folder, kept in its library's trash until
+// it is restored or purged
+type TrashItem struct {
+	ID           string    `json:"id"`
+	Library      string    `json:"library"`
+	Name         string    `json:"name"`
+	OriginalPath string    `json:"original_path"` // Relative to the library
+	DeletedAt    time.Time `json:"deleted_at"`
+	Size         int64     `json:"size"` // Total of all files for folders
+	IsFolder     bool      `json:"is_folder"`
+}
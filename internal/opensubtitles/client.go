@@ -0,0 +1,200 @@
+// Package opensubtitles is a client for the OpenSubtitles REST API
+package opensubtitles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"golang.org/x/time/rate"
+)
+
+const (
+	BaseURL         = "https://api.opensubtitles.com/api/v1"
+	UserAgent       = "rd-downloader v1.0"
+	RateLimitPerSec = 5
+)
+
+// APIError is returned when OpenSubtitles answers with an error status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+type Client struct {
+	baseURL    string
+	apiKey     string
+	username   string
+	password   string
+	httpClient *http.Client
+	limiter    *rate.Limiter
+
+	loginMu sync.Mutex
+	mu      sync.Mutex // Guards baseURL and token
+	token   string     // Set after logging in
+}
+
+// NewClient creates a client for the API at baseURL, or BaseURL when it is
+// "". Logging in is optional, but raises the daily download quota.
+func NewClient(baseURL, apiKey, username, password string) *Client {
+	if baseURL == "" {
+		baseURL = BaseURL
+	}
+	return &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		apiKey:   apiKey,
+		username: username,
+		password: password,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		limiter: rate.NewLimiter(rate.Every(time.Second/RateLimitPerSec), 1),
+	}
+}
+
+func (c *Client) doRequest(ctx context.Context, method, endpoint string, data interface{}) (*http.Response, error) {
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, method, endpoint, data, token)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized && token != "" {
+		// Tokens expire after a day, so log in again once
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		if token, err = c.authToken(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = c.send(ctx, method, endpoint, data, token)
+	}
+	return resp, err
+}
+
+func (c *Client) send(ctx context.Context, method, endpoint string, data interface{}, token string) (*http.Response, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	var body io.Reader
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	c.mu.Lock()
+	reqURL := c.baseURL + endpoint
+	c.mu.Unlock()
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Api-Key", c.apiKey)
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) get(ctx context.Context, endpoint string, result interface{}) error {
+	resp, err := c.doRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, data, result interface{}) error {
+	resp, err := c.doRequest(ctx, http.MethodPost, endpoint, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// authToken returns the session token, logging in first if credentials
+// are set. Without them requests are anonymous and it returns "".
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	if c.username == "" {
+		return "", nil
+	}
+
+	// Only one request logs in, the others wait for its token
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	if token != "" {
+		return token, nil
+	}
+
+	credentials := map[string]string{"username": c.username, "password": c.password}
+	resp, err := c.send(ctx, http.MethodPost, "/login", credentials, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to log in: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var login models.SubtitleLogin
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", fmt.Errorf("failed to decode login response: %w", err)
+	}
+	if login.Token == "" {
+		return "", fmt.Errorf("failed to log in: no token returned")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = login.Token
+	// VIP accounts are told to use their own host
+	if login.BaseURL != "" && c.baseURL == BaseURL {
+		c.baseURL = "https://" + login.BaseURL + "/api/v1"
+	}
+	return c.token, nil
+}
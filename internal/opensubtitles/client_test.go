@@ -0,0 +1,261 @@
+package opensubtitles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standIn plays the OpenSubtitles API, handing out a new token on each
+// login and accepting only the latest one
+type standIn struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	logins      int
+	token       string
+	queries     []string // Raw query of each search
+	downloads   []map[string]interface{}
+	fileHeaders http.Header // Headers of the last subtitle file request
+	status      int         // Answer searches with this status when set
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *standIn) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/files/") {
+		s.fileHeaders = r.Header.Clone()
+		fmt.Fprintf(w, "1\n00:00:01,000 --> 00:00:02,000\n%s\n", strings.TrimPrefix(r.URL.Path, "/files/"))
+		return
+	}
+	if r.Header.Get("Api-Key") != "key" {
+		http.Error(w, `{"message":"invalid api key"}`, http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/login":
+		var creds map[string]string
+		json.NewDecoder(r.Body).Decode(&creds)
+		if creds["username"] != "user" || creds["password"] != "secret" {
+			http.Error(w, `{"message":"bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		s.logins++
+		s.token = fmt.Sprintf("token-%d", s.logins)
+		json.NewEncoder(w).Encode(map[string]string{"token": s.token})
+	case "/subtitles":
+		if !s.authorized(r) {
+			http.Error(w, `{"message":"token expired"}`, http.StatusUnauthorized)
+			return
+		}
+		if s.status != 0 {
+			http.Error(w, `{"message":"try later"}`, s.status)
+			return
+		}
+		s.queries = append(s.queries, r.URL.RawQuery)
+		w.Write([]byte(`{"total_count":1,"data":[{"id":"9","attributes":{"language":"en","download_count":12,"moviehash_match":true,"files":[{"file_id":42,"file_name":"movie.srt"}]}}]}`))
+	case "/download":
+		if !s.authorized(r) {
+			http.Error(w, `{"message":"token expired"}`, http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.downloads = append(s.downloads, body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"link":      fmt.Sprintf("%s/files/%v", s.URL, body["file_id"]),
+			"file_name": "movie.srt",
+			"remaining": 19,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized accepts anonymous requests and the current token
+func (s *standIn) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	return auth == "" || auth == "Bearer "+s.token
+}
+
+func TestLoginReusesToken(t *testing.T) {
+	server := newStandIn(t)
+	client := NewClient(server.URL, "key", "user", "secret")
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Search(context.Background(), SearchParams{Query: "movie"}); err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+	}
+	if server.logins != 1 {
+		t.Errorf("logged in %d times, want 1", server.logins)
+	}
+}
+
+func TestLoginAgainWhenTokenExpires(t *testing.T) {
+	server := newStandIn(t)
+	client := NewClient(server.URL, "key", "user", "secret")
+
+	if _, err := client.Search(context.Background(), SearchParams{Query: "movie"}); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	server.mu.Lock()
+	server.token = "expired"
+	server.mu.Unlock()
+
+	if _, err := client.Search(context.Background(), SearchParams{Query: "movie"}); err != nil {
+		t.Fatalf("Search after expiry: %v", err)
+	}
+	if server.logins != 2 {
+		t.Errorf("logged in %d times, want 2", server.logins)
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	server := newStandIn(t)
+	client := NewClient(server.URL, "key", "user", "wrong")
+
+	_, err := client.Search(context.Background(), SearchParams{Query: "movie"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Search = %v, want a 401 APIError", err)
+	}
+}
+
+func TestSearchParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params SearchParams
+		want   string
+	}{
+		{
+			name:   "hash",
+			params: SearchParams{MovieHash: "8E245D9679D31E12", Languages: []string{"en"}},
+			want:   "languages=en&moviehash=8e245d9679d31e12",
+		},
+		{
+			name:   "movie title",
+			params: SearchParams{Query: "The Matrix", Year: 1999, Languages: []string{"ES", "en"}},
+			want:   "languages=en%2Ces&query=the+matrix&year=1999",
+		},
+		{
+			name:   "episode",
+			params: SearchParams{Query: "Show", Season: 2, Episode: 5, Languages: []string{"my"}},
+			want:   "episode_number=5&languages=my&query=show&season_number=2",
+		},
+	}
+
+	server := newStandIn(t)
+	client := NewClient(server.URL, "key", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := client.Search(context.Background(), tt.params)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if got := server.queries[len(server.queries)-1]; got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+			if len(results) != 1 || results[0].Attributes.Files[0].FileID != 42 {
+				t.Errorf("results = %+v", results)
+			}
+		})
+	}
+
+	if _, err := client.Search(context.Background(), SearchParams{}); err == nil {
+		t.Error("Search without a hash or query succeeded")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := newStandIn(t)
+	client := NewClient(server.URL, "key", "user", "secret")
+
+	data, err := client.Download(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if !strings.Contains(string(data), "00:00:01,000 --> 00:00:02,000\n42") {
+		t.Errorf("downloaded %q", data)
+	}
+
+	request := server.downloads[0]
+	if request["file_id"] != float64(42) || request["sub_format"] != "srt" {
+		t.Errorf("download request = %v", request)
+	}
+	if server.fileHeaders.Get("Api-Key") != "" || server.fileHeaders.Get("Authorization") != "" {
+		t.Error("API credentials were sent to the file server")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := newStandIn(t)
+			server.status = status
+			client := NewClient(server.URL, "key", "", "")
+
+			_, err := client.Search(context.Background(), SearchParams{Query: "movie"})
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != status {
+				t.Fatalf("Search = %v, want a %d APIError", err, status)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	// Two little-endian words, 1 and 2, read once from each end
+	short := make([]byte, 16)
+	short[0], short[8] = 1, 2
+
+	// The head and tail words counted are the first and last ones only
+	long := make([]byte, 200000)
+	long[0] = 5
+	long[len(long)-8] = 7
+	long[100000] = 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "0000000000000000"},
+		{"short", short, fmt.Sprintf("%016x", 16+3+3)},
+		{"exactly 64KB", make([]byte, 65536), "0000000000010000"},
+		{"long", long, fmt.Sprintf("%016x", 200000+5+7)},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Hash(path)
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Hash = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
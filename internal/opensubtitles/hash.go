@@ -0,0 +1,42 @@
+package opensubtitles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hashChunkSize is how much of each end of a file the hash reads
+const hashChunkSize = 64 << 10
+
+// Hash computes the OpenSubtitles movie hash of a video: its size plus the
+// sum of the 64-bit little-endian words of its first and last 64KB. Files
+// shorter than that are read whole from each end, padded with zeros.
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+	chunk := min(size, hashChunkSize)
+
+	hash := uint64(size)
+	buf := make([]byte, hashChunkSize)
+	for _, offset := range []int64{0, size - chunk} {
+		clear(buf)
+		if _, err := f.ReadAt(buf[:chunk], offset); err != nil && err != io.EOF {
+			return "", err
+		}
+		for i := 0; i < len(buf); i += 8 {
+			hash += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
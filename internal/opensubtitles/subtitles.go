@@ -0,0 +1,102 @@
+package opensubtitles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// maxSubtitleSize bounds the subtitle files downloaded into memory
+const maxSubtitleSize = 16 << 20
+
+// SearchParams selects subtitles. A movie hash finds subtitles timed for
+// that exact file, the title fields search by name.
+type SearchParams struct {
+	MovieHash string
+	Query     string
+	Year      int
+	Season    int
+	Episode   int
+	Languages []string // ISO 639-1 codes such as en or pt-br
+}
+
+// Search finds subtitles matching params, the first page of results only
+func (c *Client) Search(ctx context.Context, params SearchParams) ([]models.SubtitleResult, error) {
+	// The API redirects requests whose parameters aren't lowercase and
+	// sorted, which Encode takes care of
+	query := url.Values{}
+	if params.MovieHash != "" {
+		query.Set("moviehash", strings.ToLower(params.MovieHash))
+	}
+	if params.Query != "" {
+		query.Set("query", strings.ToLower(params.Query))
+	}
+	if params.Year > 0 {
+		query.Set("year", strconv.Itoa(params.Year))
+	}
+	if params.Season > 0 {
+		query.Set("season_number", strconv.Itoa(params.Season))
+	}
+	if params.Episode > 0 {
+		query.Set("episode_number", strconv.Itoa(params.Episode))
+	}
+	if len(params.Languages) > 0 {
+		languages := make([]string, len(params.Languages))
+		for i, lang := range params.Languages {
+			languages[i] = strings.ToLower(lang)
+		}
+		sort.Strings(languages)
+		query.Set("languages", strings.Join(languages, ","))
+	}
+	if len(query) == 0 {
+		return nil, fmt.Errorf("a movie hash or query is required")
+	}
+
+	var result models.SubtitleSearchResponse
+	if err := c.get(ctx, "/subtitles?"+query.Encode(), &result); err != nil {
+		return nil, fmt.Errorf("failed to search subtitles: %w", err)
+	}
+	return result.Data, nil
+}
+
+// Download fetches a subtitle file in SubRip format. Each call counts
+// against the daily download quota.
+func (c *Client) Download(ctx context.Context, fileID int) ([]byte, error) {
+	var link models.SubtitleDownload
+	request := map[string]interface{}{"file_id": fileID, "sub_format": "srt"}
+	if err := c.post(ctx, "/download", request, &link); err != nil {
+		return nil, fmt.Errorf("failed to request subtitle download: %w", err)
+	}
+	if link.Link == "" {
+		return nil, fmt.Errorf("failed to request subtitle download: %s", link.Message)
+	}
+
+	// The link points at a file server, which wants none of the API headers
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.Link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download subtitle: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSubtitleSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download subtitle: %w", err)
+	}
+	return data, nil
+}
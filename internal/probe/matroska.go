@@ -0,0 +1,414 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// Matroska element IDs, with their length marker bits kept
+const (
+	mkvEBML          = 0x1A45DFA3
+	mkvSegment       = 0x18538067
+	mkvSeekHead      = 0x114D9B74
+	mkvSeek          = 0x4DBB
+	mkvSeekID        = 0x53AB
+	mkvSeekPosition  = 0x53AC
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackType     = 0x83
+	mkvCodecID       = 0x86
+	mkvLanguage      = 0x22B59C
+	mkvLanguageBCP47 = 0x22B59D
+	mkvName          = 0x536E
+	mkvFlagDefault   = 0x88
+	mkvFlagForced    = 0x55AA
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+	mkvAudio         = 0xE1
+	mkvChannels      = 0x9F
+	mkvCluster       = 0x1F43B675
+)
+
+// Matroska track types
+const (
+	mkvTrackVideo    = 1
+	mkvTrackAudio    = 2
+	mkvTrackSubtitle = 0x11
+)
+
+// maxMatroskaElement bounds the header elements read into memory
+const maxMatroskaElement = 16 << 20
+
+var matroskaCodecs = map[string]string{
+	"V_MPEGH/ISO/HEVC":   "HEVC",
+	"V_MPEG4/ISO/AVC":    "H.264",
+	"V_AV1":              "AV1",
+	"V_VP9":              "VP9",
+	"V_VP8":              "VP8",
+	"V_MPEG2":            "MPEG-2",
+	"V_MPEG4/ISO/ASP":    "MPEG-4",
+	"V_MS/VFW/FOURCC":    "VfW",
+	"A_AAC":              "AAC",
+	"A_AC3":              "AC-3",
+	"A_EAC3":             "E-AC-3",
+	"A_DTS":              "DTS",
+	"A_TRUEHD":           "TrueHD",
+	"A_FLAC":             "FLAC",
+	"A_OPUS":             "Opus",
+	"A_VORBIS":           "Vorbis",
+	"A_MPEG/L3":          "MP3",
+	"A_MPEG/L2":          "MP2",
+	"A_PCM/INT/LIT":      "PCM",
+	"S_TEXT/UTF8":        "SRT",
+	"S_TEXT/ASS":         "ASS",
+	"S_TEXT/SSA":         "SSA",
+	"S_ASS":              "ASS",
+	"S_SSA":              "SSA",
+	"S_TEXT/WEBVTT":      "WebVTT",
+	"S_HDMV/PGS":         "PGS",
+	"S_HDMV/TEXTST":      "TextST",
+	"S_VOBSUB":           "VobSub",
+	"S_DVBSUB":           "DVB",
+	"D_WEBVTT/SUBTITLES": "WebVTT",
+}
+
+// matroskaCodec names a codec ID, matching prefixes such as A_AAC/MPEG4/LC
+func matroskaCodec(id string) string {
+	if name, ok := matroskaCodecs[id]; ok {
+		return name
+	}
+	for prefix, name := range matroskaCodecs {
+		if strings.HasPrefix(id, prefix+"/") {
+			return name
+		}
+	}
+	return id
+}
+
+// ebmlElement is an element header read from a file
+type ebmlElement struct {
+	id      uint64
+	size    uint64
+	unknown bool  // Size not given, the element runs to the end of its parent
+	data    int64 // Offset of the element's data
+}
+
+func probeMatroska(r io.ReadSeeker) (*models.MediaInfo, error) {
+	header, err := readElement(r)
+	if err != nil || header.id != mkvEBML {
+		return nil, ErrUnsupported
+	}
+	if _, err := r.Seek(int64(header.size), io.SeekCurrent); err != nil {
+		return nil, err
+	}
+
+	segment, err := readElement(r)
+	if err != nil {
+		return nil, err
+	}
+	if segment.id != mkvSegment {
+		return nil, fmt.Errorf("expected a Segment, found element %X", segment.id)
+	}
+	end := int64(math.MaxInt64)
+	if !segment.unknown {
+		end = segment.data + int64(segment.size)
+	}
+
+	var infoData, tracksData []byte
+	seeks := make(map[uint64]int64)
+
+	// Info and Tracks normally come before the first Cluster. If not, the
+	// SeekHead says where they are.
+	for offset := segment.data; offset < end && (infoData == nil || tracksData == nil); {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		el, err := readElement(r)
+		if err != nil {
+			break
+		}
+		if el.id == mkvCluster || el.unknown {
+			break
+		}
+
+		switch el.id {
+		case mkvInfo, mkvTracks, mkvSeekHead:
+			data, err := readData(r, el)
+			if err != nil {
+				return nil, err
+			}
+			switch el.id {
+			case mkvInfo:
+				infoData = data
+			case mkvTracks:
+				tracksData = data
+			case mkvSeekHead:
+				parseSeekHead(data, seeks)
+			}
+		}
+		offset = el.data + int64(el.size)
+	}
+
+	for _, want := range []struct {
+		id   uint64
+		data *[]byte
+	}{{mkvInfo, &infoData}, {mkvTracks, &tracksData}} {
+		pos, ok := seeks[want.id]
+		if *want.data != nil || !ok {
+			continue
+		}
+		if _, err := r.Seek(segment.data+pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+		el, err := readElement(r)
+		if err != nil || el.id != want.id {
+			continue
+		}
+		if *want.data, err = readData(r, el); err != nil {
+			return nil, err
+		}
+	}
+
+	if infoData == nil && tracksData == nil {
+		return nil, fmt.Errorf("no track information found")
+	}
+
+	info := &models.MediaInfo{}
+	parseInfo(infoData, info)
+	parseTracks(tracksData, info)
+	return info, nil
+}
+
+// parseSeekHead records where top level elements are, relative to the
+// start of the segment data
+func parseSeekHead(data []byte, seeks map[uint64]int64) {
+	eachChild(data, func(id uint64, body []byte) {
+		if id != mkvSeek {
+			return
+		}
+		var target uint64
+		var pos int64 = -1
+		eachChild(body, func(id uint64, body []byte) {
+			switch id {
+			case mkvSeekID:
+				target = readUint(body)
+			case mkvSeekPosition:
+				pos = int64(readUint(body))
+			}
+		})
+		if _, seen := seeks[target]; target != 0 && pos >= 0 && !seen {
+			seeks[target] = pos
+		}
+	})
+}
+
+func parseInfo(data []byte, info *models.MediaInfo) {
+	scale := uint64(1000000) // Nanoseconds per timecode unit
+	var duration float64
+	eachChild(data, func(id uint64, body []byte) {
+		switch id {
+		case mkvTimecodeScale:
+			scale = readUint(body)
+		case mkvDuration:
+			duration = readFloat(body)
+		}
+	})
+	info.Duration = duration * float64(scale) / 1e9
+}
+
+func parseTracks(data []byte, info *models.MediaInfo) {
+	eachChild(data, func(id uint64, body []byte) {
+		if id != mkvTrackEntry {
+			return
+		}
+
+		var kind uint64
+		var codec, lang, bcp47 string
+		var width, height int
+		track := models.MediaTrack{Default: true, Channels: 1}
+		hasLang := false
+
+		eachChild(body, func(id uint64, body []byte) {
+			switch id {
+			case mkvTrackType:
+				kind = readUint(body)
+			case mkvCodecID:
+				codec = readString(body)
+			case mkvLanguage:
+				lang, hasLang = readString(body), true
+			case mkvLanguageBCP47:
+				bcp47 = readString(body)
+			case mkvName:
+				track.Name = readString(body)
+			case mkvFlagDefault:
+				track.Default = readUint(body) != 0
+			case mkvFlagForced:
+				track.Forced = readUint(body) != 0
+			case mkvVideo:
+				eachChild(body, func(id uint64, body []byte) {
+					switch id {
+					case mkvPixelWidth:
+						width = int(readUint(body))
+					case mkvPixelHeight:
+						height = int(readUint(body))
+					}
+				})
+			case mkvAudio:
+				eachChild(body, func(id uint64, body []byte) {
+					if id == mkvChannels {
+						track.Channels = int(readUint(body))
+					}
+				})
+			}
+		})
+
+		// English is the default when a track names no language
+		switch {
+		case hasLang:
+		case bcp47 != "":
+			lang = bcp47
+		default:
+			lang = "eng"
+		}
+		track.Codec = matroskaCodec(codec)
+		track.Language = language(lang)
+
+		switch kind {
+		case mkvTrackVideo:
+			if info.VideoCodec == "" {
+				info.VideoCodec = track.Codec
+				info.Width, info.Height = width, height
+			}
+		case mkvTrackAudio:
+			info.Audio = append(info.Audio, track)
+		case mkvTrackSubtitle:
+			track.Channels = 0
+			info.Subtitles = append(info.Subtitles, track)
+		}
+	})
+}
+
+// readElement reads an element header and leaves r at the element's data
+func readElement(r io.ReadSeeker) (ebmlElement, error) {
+	id, _, err := readVint(r, true)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+	size, n, err := readVint(r, false)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+	return ebmlElement{
+		id:      id,
+		size:    size,
+		unknown: size == 1<<(7*n)-1,
+		data:    pos,
+	}, nil
+}
+
+// readData reads the data of an element r is positioned at
+func readData(r io.Reader, el ebmlElement) ([]byte, error) {
+	if el.size > maxMatroskaElement {
+		return nil, fmt.Errorf("element %X is too large", el.id)
+	}
+	data := make([]byte, el.size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errTruncated
+	}
+	return data, nil
+}
+
+// readVint reads a variable length integer. IDs keep their length marker,
+// sizes do not.
+func readVint(r io.Reader, keepMarker bool) (uint64, int, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, 0, err
+	}
+	n := bits.LeadingZeros8(buf[0]) + 1
+	if n > 8 {
+		return 0, 0, fmt.Errorf("invalid variable length integer")
+	}
+	if _, err := io.ReadFull(r, buf[1:n]); err != nil {
+		return 0, 0, errTruncated
+	}
+	v, _, _ := parseVint(buf[:n], keepMarker)
+	return v, n, nil
+}
+
+// parseVint decodes a variable length integer at the start of b
+func parseVint(b []byte, keepMarker bool) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if len(b) < n {
+		return 0, 0, false
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= 0xFF >> n
+	}
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n, true
+}
+
+// eachChild calls fn for each element in data. Parsing stops at the first
+// malformed element.
+func eachChild(data []byte, fn func(id uint64, body []byte)) {
+	for len(data) > 0 {
+		id, n, ok := parseVint(data, true)
+		if !ok {
+			return
+		}
+		data = data[n:]
+		size, n, ok := parseVint(data, false)
+		if !ok {
+			return
+		}
+		data = data[n:]
+		if size > uint64(len(data)) {
+			return
+		}
+		fn(id, data[:size])
+		data = data[size:]
+	}
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func readFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func readString(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
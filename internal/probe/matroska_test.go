@@ -0,0 +1,165 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// ebml builds an element from its ID and children, with the size written
+// as an eight byte variable length integer so lengths are easy to predict
+func ebml(id uint64, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	return ebmlSized(id, uint64(len(body)), body)
+}
+
+// ebmlSized builds an element whose header claims size, whatever its body
+func ebmlSized(id, size uint64, body []byte) []byte {
+	var out []byte
+	for shift := 56; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	var sizeBytes [8]byte
+	binary.BigEndian.PutUint64(sizeBytes[:], size)
+	sizeBytes[0] = 0x01 // Length marker, sizes stay below 2^56
+	out = append(out, sizeBytes[:]...)
+	return append(out, body...)
+}
+
+func ebmlUint(id, v uint64) []byte {
+	return ebml(id, binary.BigEndian.AppendUint64(nil, v))
+}
+
+func ebmlString(id uint64, s string) []byte {
+	return ebml(id, []byte(s))
+}
+
+func ebmlFloat(id uint64, f float64) []byte {
+	return ebml(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// mkvHeader is the EBML header every Matroska file starts with
+var mkvHeader = ebml(mkvEBML, ebmlString(0x4282, "matroska"))
+
+// mkvFile puts the EBML header in front of a segment
+func mkvFile(segment []byte) []byte {
+	return slices.Concat(mkvHeader, segment)
+}
+
+func mkvTracksElement() []byte {
+	return ebml(mkvTracks,
+		ebml(mkvTrackEntry,
+			ebmlUint(mkvTrackType, mkvTrackVideo),
+			ebmlString(mkvCodecID, "V_MPEGH/ISO/HEVC"),
+			ebml(mkvVideo, ebmlUint(mkvPixelWidth, 3840), ebmlUint(mkvPixelHeight, 1600)),
+		),
+		ebml(mkvTrackEntry,
+			ebmlUint(mkvTrackType, mkvTrackAudio),
+			ebmlString(mkvCodecID, "A_EAC3"),
+			ebmlString(mkvLanguage, "ger"),
+			ebmlString(mkvName, "Surround"),
+			ebml(mkvAudio, ebmlUint(mkvChannels, 6)),
+		),
+		ebml(mkvTrackEntry,
+			ebmlUint(mkvTrackType, mkvTrackSubtitle),
+			ebmlString(mkvCodecID, "S_TEXT/UTF8"),
+			ebmlString(mkvLanguage, "und"),
+			ebmlUint(mkvFlagDefault, 0),
+			ebmlUint(mkvFlagForced, 1),
+		),
+	)
+}
+
+var mkvWant = &models.MediaInfo{
+	Width: 3840, Height: 1600, VideoCodec: "HEVC",
+	Audio:     []models.MediaTrack{{Codec: "E-AC-3", Language: "ger", Name: "Surround", Channels: 6, Default: true}},
+	Subtitles: []models.MediaTrack{{Codec: "SRT", Forced: true}},
+}
+
+func TestMatroska(t *testing.T) {
+	info := ebml(mkvInfo, ebmlUint(mkvTimecodeScale, 1000000), ebmlFloat(mkvDuration, 5400000))
+	cluster := ebml(mkvCluster, make([]byte, 64))
+	tracks := mkvTracksElement()
+
+	withDuration := *mkvWant
+	withDuration.Duration = 5400
+
+	// A SeekHead whose Seek entries point past the first Cluster. Its size
+	// does not depend on the positions, as every integer takes eight bytes.
+	seekHead := func(infoPos, tracksPos int) []byte {
+		return ebml(mkvSeekHead,
+			ebml(mkvSeek, ebmlUint(mkvSeekID, mkvInfo), ebmlUint(mkvSeekPosition, uint64(infoPos))),
+			ebml(mkvSeek, ebmlUint(mkvSeekID, mkvTracks), ebmlUint(mkvSeekPosition, uint64(tracksPos))),
+		)
+	}
+	head := len(seekHead(0, 0))
+	seeked := ebml(mkvSegment,
+		seekHead(head+len(cluster), head+len(cluster)+len(info)),
+		cluster, info, tracks,
+	)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *models.MediaInfo
+		wantErr string
+	}{
+		{
+			name: "normal file",
+			data: mkvFile(ebml(mkvSegment, info, tracks, cluster)),
+			want: &withDuration,
+		},
+		{
+			name: "tracks found through SeekHead",
+			data: mkvFile(seeked),
+			want: &withDuration,
+		},
+		{
+			name:    "truncated header",
+			data:    mkvHeader[:len(mkvHeader)-3],
+			wantErr: "EOF",
+		},
+		{
+			name:    "truncated segment",
+			data:    mkvFile(ebml(mkvSegment, info, tracks)[:40]),
+			wantErr: errTruncated.Error(),
+		},
+		{
+			name: "element larger than the limit",
+			data: mkvFile(ebmlSized(mkvSegment, 1<<40, ebmlSized(mkvTracks, maxMatroskaElement+1, make([]byte, 16)))),
+			// The size is refused before anything is allocated
+			wantErr: "too large",
+		},
+		{
+			name:    "no Segment",
+			data:    mkvFile(ebml(mkvInfo)),
+			wantErr: "expected a Segment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Reader(bytes.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Reader = %+v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reader: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Reader\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
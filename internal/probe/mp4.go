@@ -0,0 +1,306 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// maxLeafBox bounds the header boxes read into memory
+const maxLeafBox = 1 << 20
+
+var mp4Codecs = map[string]string{
+	"avc1": "H.264",
+	"avc3": "H.264",
+	"hvc1": "HEVC",
+	"hev1": "HEVC",
+	"dvh1": "HEVC",
+	"dvhe": "HEVC",
+	"av01": "AV1",
+	"vp09": "VP9",
+	"vp08": "VP8",
+	"mp4v": "MPEG-4",
+	"apch": "ProRes",
+	"apcn": "ProRes",
+	"apcs": "ProRes",
+	"apco": "ProRes",
+	"ap4h": "ProRes",
+	"mp4a": "AAC",
+	"ac-3": "AC-3",
+	"ec-3": "E-AC-3",
+	"ac-4": "AC-4",
+	"dtsc": "DTS",
+	"dtsh": "DTS",
+	"dtsl": "DTS",
+	"mlpa": "TrueHD",
+	"Opus": "Opus",
+	"fLaC": "FLAC",
+	"alac": "ALAC",
+	".mp3": "MP3",
+	"tx3g": "TX3G",
+	"text": "Text",
+	"wvtt": "WebVTT",
+	"stpp": "TTML",
+	"c608": "CEA-608",
+	"c708": "CEA-708",
+}
+
+// mp4Box is a box header read from a file
+type mp4Box struct {
+	typ  string
+	data int64 // Offset of the box's payload
+	end  int64
+}
+
+// mp4Track collects what a trak box says about its track
+type mp4Track struct {
+	handler  string
+	codec    string
+	language string
+	width    int
+	height   int
+	channels int
+}
+
+func probeMP4(r io.ReadSeeker) (*models.MediaInfo, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *models.MediaInfo
+	err = eachBox(r, 0, size, func(b mp4Box) error {
+		if b.typ != "moov" {
+			return nil
+		}
+		info = &models.MediaInfo{}
+		return parseMoov(r, b, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		// moov is written last by some muxers, so a partial download lacks it
+		return nil, fmt.Errorf("no movie header found")
+	}
+	return info, nil
+}
+
+func parseMoov(r io.ReadSeeker, moov mp4Box, info *models.MediaInfo) error {
+	return eachBox(r, moov.data, moov.end, func(b mp4Box) error {
+		switch b.typ {
+		case "mvhd":
+			data, err := readBox(r, b)
+			if err != nil {
+				return err
+			}
+			info.Duration = mvhdDuration(data)
+		case "trak":
+			var t mp4Track
+			if err := parseTrak(r, b, &t, 0); err != nil {
+				return err
+			}
+			addTrack(info, t)
+		}
+		return nil
+	})
+}
+
+// maxBoxDepth bounds how deep parseTrak follows nested boxes. Real files
+// need three levels, mdia/minf/stbl, while a crafted one could nest them
+// until the stack overflows.
+const maxBoxDepth = 8
+
+func parseTrak(r io.ReadSeeker, trak mp4Box, t *mp4Track, depth int) error {
+	if depth > maxBoxDepth {
+		return fmt.Errorf("boxes nested too deeply")
+	}
+	return eachBox(r, trak.data, trak.end, func(b mp4Box) error {
+		switch b.typ {
+		case "tkhd":
+			data, err := readBox(r, b)
+			if err != nil {
+				return err
+			}
+			// Presentation size, used when the sample entry has none
+			if n := len(data); n >= 84 {
+				t.width = int(binary.BigEndian.Uint32(data[n-8:]) >> 16)
+				t.height = int(binary.BigEndian.Uint32(data[n-4:]) >> 16)
+			}
+		case "mdia", "minf", "stbl":
+			return parseTrak(r, b, t, depth+1)
+		case "mdhd":
+			data, err := readBox(r, b)
+			if err != nil {
+				return err
+			}
+			t.language = mdhdLanguage(data)
+		case "hdlr":
+			data, err := readBox(r, b)
+			if err != nil {
+				return err
+			}
+			if len(data) >= 12 {
+				t.handler = string(data[8:12])
+			}
+		case "stsd":
+			data, err := readBox(r, b)
+			if err != nil {
+				return err
+			}
+			parseSampleEntry(data, t)
+		}
+		return nil
+	})
+}
+
+// parseSampleEntry reads the codec, and the frame size or channel count,
+// from the first entry of a sample description box
+func parseSampleEntry(data []byte, t *mp4Track) {
+	if len(data) < 16 {
+		return
+	}
+	entry := data[8:] // Skip version, flags and entry count
+	t.codec = string(entry[4:8])
+	payload := entry[8:]
+
+	switch t.handler {
+	case "vide":
+		if len(payload) >= 28 {
+			if w, h := int(binary.BigEndian.Uint16(payload[24:])), int(binary.BigEndian.Uint16(payload[26:])); w > 0 && h > 0 {
+				t.width, t.height = w, h
+			}
+		}
+	case "soun":
+		if len(payload) >= 18 {
+			t.channels = int(binary.BigEndian.Uint16(payload[16:]))
+		}
+	}
+}
+
+func addTrack(info *models.MediaInfo, t mp4Track) {
+	codec := t.codec
+	if name, ok := mp4Codecs[codec]; ok {
+		codec = name
+	}
+	codec = strings.TrimSpace(codec)
+
+	switch t.handler {
+	case "vide":
+		if info.VideoCodec == "" {
+			info.VideoCodec = codec
+			info.Width, info.Height = t.width, t.height
+		}
+	case "soun":
+		info.Audio = append(info.Audio, models.MediaTrack{
+			Codec:    codec,
+			Language: t.language,
+			Channels: t.channels,
+		})
+	case "sbtl", "subt", "text", "clcp":
+		info.Subtitles = append(info.Subtitles, models.MediaTrack{
+			Codec:    codec,
+			Language: t.language,
+		})
+	}
+}
+
+// mvhdDuration converts the movie duration to seconds
+func mvhdDuration(data []byte) float64 {
+	var timescale, duration uint64
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(data[20:]))
+		duration = binary.BigEndian.Uint64(data[24:])
+	case len(data) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(data[12:]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	}
+	if timescale == 0 || duration == 0xFFFFFFFF || duration == 1<<64-1 {
+		return 0
+	}
+	return float64(duration) / float64(timescale)
+}
+
+// mdhdLanguage decodes the packed ISO 639-2 code of a media header.
+// QuickTime files may hold a Macintosh language code instead, where 0 is
+// English.
+func mdhdLanguage(data []byte) string {
+	offset := 20
+	if len(data) > 0 && data[0] == 1 {
+		offset = 32
+	}
+	if len(data) < offset+2 {
+		return ""
+	}
+	packed := binary.BigEndian.Uint16(data[offset:]) & 0x7FFF
+	if packed < 0x400 {
+		if packed == 0 {
+			return "eng"
+		}
+		return ""
+	}
+	lang := []byte{
+		byte(packed>>10&0x1F) + 0x60,
+		byte(packed>>5&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	}
+	return language(string(lang))
+}
+
+// eachBox calls fn for each box between start and end. A box running past
+// end, as in a partial download, stops the iteration.
+func eachBox(r io.ReadSeeker, start, end int64, fn func(b mp4Box) error) error {
+	var header [16]byte
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0: // Runs to the end of the file
+			size = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		// Compared as end-offset, since offset+size can overflow for a
+		// 64-bit size near the maximum
+		if size < headerSize || size > end-offset {
+			return nil
+		}
+
+		b := mp4Box{typ: string(header[4:8]), data: offset + headerSize, end: offset + size}
+		if err := fn(b); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+// readBox reads the payload of a leaf box
+func readBox(r io.ReadSeeker, b mp4Box) ([]byte, error) {
+	if b.end-b.data > maxLeafBox {
+		return nil, fmt.Errorf("%s box is too large", b.typ)
+	}
+	if _, err := r.Seek(b.data, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, b.end-b.data)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errTruncated
+	}
+	return data, nil
+}
@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// box builds an MP4 box with a 32-bit size
+func box(typ string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// largeBox builds the header of a box with a 64-bit size and no body
+func largeBox(typ string, size uint64) []byte {
+	out := binary.BigEndian.AppendUint32(nil, 1)
+	out = append(out, typ...)
+	return binary.BigEndian.AppendUint64(out, size)
+}
+
+// u16 and u32 write big-endian fields
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// packedLanguage encodes an ISO 639-2 code as a media header stores it
+func packedLanguage(lang string) []byte {
+	return u16(uint16(lang[0]-0x60)<<10 | uint16(lang[1]-0x60)<<5 | uint16(lang[2]-0x60))
+}
+
+// mp4Trak builds a track with a handler, a language and one sample entry
+func mp4Trak(handler, lang string, entry []byte) []byte {
+	mdhd := box("mdhd", make([]byte, 20), packedLanguage(lang), u16(0))
+	hdlr := box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 12))
+	stsd := box("stsd", u32(0), u32(1), entry)
+	return box("trak",
+		box("tkhd", make([]byte, 84)),
+		box("mdia", mdhd, hdlr, box("minf", box("stbl", stsd))),
+	)
+}
+
+func videoEntry(codec string, width, height uint16) []byte {
+	return box(codec, make([]byte, 24), u16(width), u16(height), make([]byte, 50))
+}
+
+func audioEntry(codec string, channels uint16) []byte {
+	return box(codec, make([]byte, 16), u16(channels), make([]byte, 10))
+}
+
+func TestMP4(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(512), []byte("isomiso2avc1mp41"))
+	mvhd := box("mvhd", make([]byte, 12), u32(1000), u32(90000), make([]byte, 80))
+	video := mp4Trak("vide", "und", videoEntry("avc1", 1920, 800))
+	audio := mp4Trak("soun", "fre", audioEntry("ec-3", 6))
+	subs := mp4Trak("sbtl", "eng", box("tx3g", make([]byte, 30)))
+
+	want := &models.MediaInfo{
+		Duration: 90, Width: 1920, Height: 800, VideoCodec: "H.264",
+		Audio:     []models.MediaTrack{{Codec: "E-AC-3", Language: "fre", Channels: 6}},
+		Subtitles: []models.MediaTrack{{Codec: "TX3G", Language: "eng"}},
+	}
+
+	// Nested mdia boxes, one level more than parseTrak follows
+	deep := box("stbl", box("stsd", u32(0), u32(1), videoEntry("avc1", 1, 1)))
+	for i := 0; i <= maxBoxDepth; i++ {
+		deep = box("mdia", deep)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *models.MediaInfo
+		wantErr string
+	}{
+		{
+			name: "normal file",
+			data: bytes.Join([][]byte{ftyp, box("moov", mvhd, video, audio, subs), box("mdat", make([]byte, 256))}, nil),
+			want: want,
+		},
+		{
+			name: "moov at the end",
+			data: bytes.Join([][]byte{ftyp, box("mdat", make([]byte, 256)), box("moov", mvhd, video, audio, subs)}, nil),
+			want: want,
+		},
+		{
+			name:    "truncated header",
+			data:    bytes.Join([][]byte{ftyp, box("moov", mvhd, video, audio, subs)[:100]}, nil),
+			wantErr: "no movie header",
+		},
+		{
+			name:    "moov missing",
+			data:    bytes.Join([][]byte{ftyp, box("mdat", make([]byte, 256))}, nil),
+			wantErr: "no movie header",
+		},
+		{
+			// The size overflows when added to the box's offset; the box is
+			// dropped as running past the end rather than wrapping around
+			name: "64-bit size near MaxInt64",
+			data: bytes.Join([][]byte{ftyp, box("moov", mvhd, video, largeBox("trak", math.MaxInt64-4))}, nil),
+			want: &models.MediaInfo{Duration: 90, Width: 1920, Height: 800, VideoCodec: "H.264"},
+		},
+		{
+			name:    "64-bit size past the end",
+			data:    bytes.Join([][]byte{ftyp, largeBox("moov", 1<<40)}, nil),
+			wantErr: "no movie header",
+		},
+		{
+			name:    "nesting deeper than maxBoxDepth",
+			data:    bytes.Join([][]byte{ftyp, box("moov", mvhd, box("trak", deep))}, nil),
+			wantErr: "nested too deeply",
+		},
+		{
+			name:    "leaf box larger than the limit",
+			data:    bytes.Join([][]byte{ftyp, box("moov", box("mvhd", make([]byte, maxLeafBox+1)))}, nil),
+			wantErr: "too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Reader(bytes.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Reader = %+v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reader: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Reader\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package probe reads stream details from the headers of Matroska/WebM and
+// MP4/MOV files without decoding any media
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// ErrUnsupported is returned for files that are not Matroska or MP4
+var ErrUnsupported = errors.New("unsupported container")
+
+// File probes the media file at path
+func File(path string) (*models.MediaInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Reader(f)
+}
+
+// Reader probes a media file, detecting the container from its first bytes
+func Reader(r io.ReadSeeker) (*models.MediaInfo, error) {
+	var head [12]byte
+	n, err := io.ReadFull(r, head[:])
+	if err != nil && n < 8 {
+		return nil, ErrUnsupported
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(head[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return probeMatroska(r)
+	case isBoxType(head[4:8]):
+		return probeMP4(r)
+	}
+	return nil, ErrUnsupported
+}
+
+// isBoxType reports whether b names an ISO BMFF box found at the start of
+// MP4 and QuickTime files
+func isBoxType(b []byte) bool {
+	switch string(b) {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "pnot":
+		return true
+	}
+	return false
+}
+
+// language normalises a track language, dropping "und"
+func language(lang string) string {
+	if lang == "und" {
+		return ""
+	}
+	return lang
+}
+
+// errTruncated is returned for elements that run past the end of the data
+var errTruncated = errors.New("truncated file")
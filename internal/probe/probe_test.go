@@ -0,0 +1,25 @@
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReaderUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"shorter than a box header", []byte{0x1A, 0x45, 0xDF}},
+		{"avi", append([]byte("RIFF\x00\x00\x00\x00AVI LIST"), make([]byte, 32)...)},
+		{"text", []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n")},
+		{"ebml without its header", append([]byte{0x1A, 0x45, 0xDF, 0xA3}, 0xFF)},
+	}
+	for _, tt := range tests {
+		if _, err := Reader(bytes.NewReader(tt.data)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: Reader error = %v, want ErrUnsupported", tt.name, err)
+		}
+	}
+}
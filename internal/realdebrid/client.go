@@ -18,6 +18,16 @@ const (
 	RateLimitPerMin = 250
 )
 
+// APIError is returned when Real-Debrid answers with an error status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
 type Client struct {
 	apiKey     string
 	httpClient *http.Client
@@ -62,7 +72,7 @@ func (c *Client) doRequest(ctx context.Context, method, endpoint string, body io
 	if resp.StatusCode >= 400 {
 		defer resp.Body.Close()
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 	}
 
 	return resp, nil
@@ -0,0 +1,316 @@
+// Package release reads quality and episode details out of release names
+package release
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// token wraps a pattern so it only matches as a whole word, where words are
+// separated by spaces, dots, underscores, dashes or brackets
+func token(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[\s._\-\[\(])(` + pattern + `)(?:$|[\s._\-\]\),+])`)
+}
+
+// variant maps the spellings of one attribute to its canonical name
+type variant struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var (
+	yearRe = token(`(?:19|20)\d{2}`)
+
+	// S01E02, S01E02E03, S01E02-E05, S01E02-05, S01.E02
+	seasonEpisodeRe = token(`S(\d{1,2})[\s._-]?(E\d{1,3}(?:(?:[\s._-]?E|-)\d{1,3})*)`)
+	episodeNumRe    = regexp.MustCompile(`(?i)(-?)E?(\d{1,3})`)
+	// 1x02, 1x02-1x03
+	crossEpisodeRe = token(`(\d{1,2})x(\d{2,3})(?:-(?:\d{1,2}x)?(\d{2,3}))?`)
+	// S01-S03, S01-03, S01
+	seasonRangeRe = token(`S(\d{1,2})(?:[\s._]?-[\s._]?S?(\d{1,2}))?`)
+	// Season 1, Season 1-3
+	seasonWordRe = token(`Season[\s._]?(\d{1,2})(?:[\s._]?-[\s._]?(\d{1,2}))?`)
+	// Show - 01, Show - 01v2
+	animeEpisodeRe = regexp.MustCompile(`\s-\s(\d{1,4})(?:v\d)?(?:$|[\s\[\(])`)
+
+	resolutions = []variant{
+		{"2160p", token(`2160p|4K|UHD|3840x2160`)},
+		{"1080p", token(`1080p|1920x1080`)},
+		{"1080i", token(`1080i`)},
+		{"720p", token(`720p|1280x720`)},
+		{"576p", token(`576p`)},
+		{"480p", token(`480p`)},
+	}
+
+	// Checked in order, so more specific sources come first
+	sources = []variant{
+		{"Remux", token(`(?:BD|UHD|BluRay)?[\s._-]?Remux`)},
+		{"BluRay", token(`Blu-?Ray|BDRip|BRRip|BDMV|BD25|BD50`)},
+		{"WEB-DL", token(`WEB-?DL|WEB`)},
+		{"WEBRip", token(`WEB-?Rip`)},
+		{"HDTV", token(`HDTV|PDTV`)},
+		{"DVDRip", token(`DVD-?Rip`)},
+		{"DVD", token(`DVD(?:5|9|R)?|NTSC|PAL`)},
+		{"HDRip", token(`HDRip`)},
+		{"Telesync", token(`TELESYNC|HDTS|HD-TS`)},
+		{"Screener", token(`DVDSCR|SCREENER|SCR`)},
+		{"CAM", token(`CAM|HDCAM|CAMRip`)},
+	}
+
+	videoCodecs = []variant{
+		{"H.265", token(`[xh]\.?265|HEVC`)},
+		{"H.264", token(`[xh]\.?264|AVC`)},
+		{"AV1", token(`AV1`)},
+		{"VP9", token(`VP9`)},
+		{"XviD", token(`XviD`)},
+		{"DivX", token(`DivX`)},
+		{"MPEG-2", token(`MPEG-?2`)},
+	}
+
+	audioCodecs = []variant{
+		{"DTS-HD MA", token(`DTS-?HD[\s._-]?MA`)},
+		{"DTS:X", token(`DTS[\s._:-]?X`)},
+		{"DTS-HD", token(`DTS-?HD`)},
+		{"DTS", token(`DTS`)},
+		{"TrueHD", token(`TrueHD`)},
+		{"DD+", token(`DDP(?:[257]\.[01])?|DD\+|E-?AC-?3`)},
+		{"DD", token(`DD(?:[257]\.[01])?|AC-?3|Dolby[\s._]?Digital`)},
+		{"AAC", token(`AAC(?:[257]\.[01])?`)},
+		{"FLAC", token(`FLAC`)},
+		{"Opus", token(`Opus`)},
+		{"MP3", token(`MP3`)},
+	}
+
+	channelsRe = regexp.MustCompile(`(?i)(?:DDP|DD|AAC|DTS|TrueHD|Atmos|[\s._-])([1-9])[\s._]?([01])(?:$|[\s._\-\])])`)
+	atmosRe    = token(`Atmos`)
+
+	// Checked in order, so HDR10+ is found before HDR10
+	hdrFormats = []variant{
+		{"DV", token(`DV|DoVi|Dolby[\s._]?Vision`)},
+		{"HDR10+", token(`HDR10\+|HDR10Plus`)},
+		{"HDR10", token(`HDR10`)},
+		{"HDR", token(`HDR`)},
+		{"HLG", token(`HLG`)},
+	}
+
+	properRe = token(`PROPER`)
+	repackRe = token(`REPACK\d?|RERIP`)
+
+	// Markers that end the title without carrying information of their own
+	markerRe = token(`COMPLETE|MULTi|DUAL|iNTERNAL|LiMiTED|EXTENDED|UNRATED|REMASTERED|IMAX|10bit|8bit|SUBBED|DUBBED`)
+
+	leadingTagRe  = regexp.MustCompile(`^\[([^\]]+)\][\s._-]*`)
+	trailingTagRe = regexp.MustCompile(`[\s._-]*\[[^\]]*\]$`)
+	groupRe       = regexp.MustCompile(`-([A-Za-z0-9]+)$`)
+	spaceRe       = regexp.MustCompile(`\s+`)
+
+	// Tails of dashed tokens that are not release groups
+	notGroups = map[string]bool{"HD": true, "DL": true, "MA": true, "RIP": true, "X": true, "TS": true}
+
+	mediaExtensions = map[string]bool{
+		".mkv": true, ".mp4": true, ".avi": true, ".mov": true, ".wmv": true,
+		".flv": true, ".webm": true, ".m4v": true, ".ts": true, ".m2ts": true,
+		".srt": true, ".sub": true, ".ass": true, ".ssa": true, ".vtt": true,
+		".nfo": true, ".torrent": true,
+	}
+)
+
+// Parse reads what it can from a release name. The title falls back to the
+// cleaned up name when nothing else is recognised.
+func Parse(name string) models.ReleaseInfo {
+	var info models.ReleaseInfo
+
+	s := strings.TrimSpace(name)
+	if ext := strings.ToLower(filepath.Ext(s)); mediaExtensions[ext] {
+		s = strings.TrimSuffix(s, filepath.Ext(s))
+	}
+
+	// Anime style releases put the group first: [Group] Show - 01 [1080p]
+	anime := false
+	if m := leadingTagRe.FindStringSubmatch(s); m != nil {
+		if !strings.ContainsAny(m[1], ". ") {
+			info.Group = m[1]
+			anime = true
+		}
+		s = s[len(m[0]):]
+	}
+
+	// Most names are Title.Year.Details or Title.S01E02.Details. Details
+	// are only looked for after that anchor, so titles such as "The Web"
+	// or "Cam" are left alone.
+	anchor := parseEpisodes(s, &info)
+	if loc := animeEpisodeRe.FindStringSubmatchIndex(s); anime && anchor < 0 && loc != nil {
+		info.Episodes = []int{atoi(s[loc[2]:loc[3]])}
+		anchor = loc[0]
+	}
+	if at, year := parseYear(s, anchor); at > 0 {
+		info.Year = year
+		anchor = at
+	}
+
+	from := max(anchor, 0)
+	end := len(s)
+	if anchor > 0 {
+		end = anchor
+	}
+	find := func(re *regexp.Regexp) bool {
+		for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+			if loc[2] >= from && loc[2] > 0 {
+				end = min(end, loc[2])
+				return true
+			}
+		}
+		return false
+	}
+	first := func(variants []variant) string {
+		for _, v := range variants {
+			if find(v.re) {
+				return v.name
+			}
+		}
+		return ""
+	}
+
+	info.Resolution = first(resolutions)
+	info.Source = first(sources)
+	info.VideoCodec = first(videoCodecs)
+	info.AudioCodec = first(audioCodecs)
+
+	for _, v := range hdrFormats {
+		if !find(v.re) {
+			continue
+		}
+		if (v.name == "HDR" && len(info.HDR) > 0) || (v.name == "HDR10" && slices.Contains(info.HDR, "HDR10+")) {
+			continue // Already more specific
+		}
+		info.HDR = append(info.HDR, v.name)
+	}
+
+	info.Atmos = find(atmosRe)
+	if m := channelsRe.FindStringSubmatch(s[from:]); m != nil && (info.AudioCodec != "" || info.Atmos) {
+		info.AudioChannels = m[1] + "." + m[2]
+	}
+
+	info.Proper = find(properRe)
+	info.Repack = find(repackRe)
+	find(markerRe)
+
+	// The group follows the last dash, after the title, ignoring tags such
+	// as [rarbg] that sites append
+	tail := s
+	for trailingTagRe.MatchString(tail) {
+		tail = trailingTagRe.ReplaceAllString(tail, "")
+	}
+	if m := groupRe.FindStringSubmatchIndex(tail); m != nil && m[0] >= end && info.Group == "" {
+		if group := tail[m[2]:m[3]]; !notGroups[strings.ToUpper(group)] {
+			info.Group = group
+		}
+	}
+
+	info.Title = cleanTitle(s[:end])
+	if info.Title == "" {
+		info.Title = cleanTitle(s)
+	}
+
+	return info
+}
+
+// parseEpisodes fills in seasons and episodes from the forms release names
+// use for them. It returns where they start, or -1.
+func parseEpisodes(s string, info *models.ReleaseInfo) int {
+	if loc := seasonEpisodeRe.FindStringSubmatchIndex(s); loc != nil {
+		info.Seasons = []int{atoi(s[loc[4]:loc[5]])}
+		info.Episodes = episodeList(s[loc[6]:loc[7]])
+		return loc[2]
+	}
+
+	if loc := crossEpisodeRe.FindStringSubmatchIndex(s); loc != nil {
+		info.Seasons = []int{atoi(s[loc[4]:loc[5]])}
+		from := atoi(s[loc[6]:loc[7]])
+		to := from
+		if loc[8] >= 0 {
+			to = atoi(s[loc[8]:loc[9]])
+		}
+		info.Episodes = span(from, to)
+		return loc[2]
+	}
+
+	for _, re := range []*regexp.Regexp{seasonRangeRe, seasonWordRe} {
+		if loc := re.FindStringSubmatchIndex(s); loc != nil {
+			from := atoi(s[loc[4]:loc[5]])
+			to := from
+			if loc[6] >= 0 {
+				to = atoi(s[loc[6]:loc[7]])
+			}
+			info.Seasons = span(from, to)
+			return loc[2]
+		}
+	}
+
+	return -1
+}
+
+// episodeList expands E01E02, E01-E03 and E01-03 into episode numbers
+func episodeList(s string) []int {
+	var episodes []int
+	for _, m := range episodeNumRe.FindAllStringSubmatch(s, -1) {
+		n := atoi(m[2])
+		if m[1] == "-" && len(episodes) > 0 {
+			episodes = append(episodes, span(episodes[len(episodes)-1]+1, n)...)
+			continue
+		}
+		episodes = append(episodes, n)
+	}
+	return episodes
+}
+
+// parseYear finds the release year and where it starts. Titles can
+// contain years too, as in Blade.Runner.2049.2017, so the last one before
+// the episode numbers wins, and one at the very start is always part of
+// the title.
+func parseYear(s string, before int) (at, year int) {
+	// Step over each match by hand, since back to back years share the
+	// separator between them
+	for offset := 0; offset < len(s); {
+		loc := yearRe.FindStringSubmatchIndex(s[offset:])
+		if loc == nil {
+			break
+		}
+		start, stop := offset+loc[2], offset+loc[3]
+		if before >= 0 && start > before {
+			break
+		}
+		if start > 0 {
+			at, year = start, atoi(s[start:stop])
+		}
+		offset = stop
+	}
+	return at, year
+}
+
+func cleanTitle(s string) string {
+	s = strings.NewReplacer(".", " ", "_", " ").Replace(s)
+	s = spaceRe.ReplaceAllString(s, " ")
+	return strings.Trim(s, " -([{")
+}
+
+func span(from, to int) []int {
+	if to < from {
+		return []int{from}
+	}
+	out := make([]int, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		out = append(out, i)
+	}
+	return out
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,149 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		want models.ReleaseInfo
+	}{
+		// Movies with a year
+		{"The.Matrix.1999.1080p.BluRay.x264.DTS-HD.MA.5.1-FGT", models.ReleaseInfo{
+			Title: "The Matrix", Year: 1999, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264",
+			AudioCodec: "DTS-HD MA", AudioChannels: "5.1", Group: "FGT",
+		}},
+		{"Interstellar.2014.1080p.BluRay.AAC2.0.x264", models.ReleaseInfo{
+			Title: "Interstellar", Year: 2014, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264",
+			AudioCodec: "AAC", AudioChannels: "2.0",
+		}},
+		{"Blade.Runner.1982.Final.Cut.1080p.BluRay.TrueHD.7.1-GRP", models.ReleaseInfo{
+			Title: "Blade Runner", Year: 1982, Resolution: "1080p", Source: "BluRay",
+			AudioCodec: "TrueHD", AudioChannels: "7.1", Group: "GRP",
+		}},
+		{"Oppenheimer.2023.IMAX.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265-FLUX.mkv", models.ReleaseInfo{
+			Title: "Oppenheimer", Year: 2023, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265",
+			AudioCodec: "DD+", AudioChannels: "5.1", Atmos: true, HDR: []string{"DV"}, Group: "FLUX",
+		}},
+		{"Movie.Name.2021.PROPER.REPACK.1080p.WEB.h264-GRP", models.ReleaseInfo{
+			Title: "Movie Name", Year: 2021, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264",
+			Group: "GRP", Proper: true, Repack: true,
+		}},
+		{"Cam.2018.1080p.NF.WEB-DL.DDP5.1.x264-NTG", models.ReleaseInfo{
+			Title: "Cam", Year: 2018, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264",
+			AudioCodec: "DD+", AudioChannels: "5.1", Group: "NTG",
+		}},
+		{"The.Web.2020.720p.WEBRip", models.ReleaseInfo{
+			Title: "The Web", Year: 2020, Resolution: "720p", Source: "WEBRip",
+		}},
+
+		// Years inside titles
+		{"Blade.Runner.2049.2017.2160p.UHD.BluRay.REMUX.HDR.HEVC.Atmos-EPSiLON", models.ReleaseInfo{
+			Title: "Blade Runner 2049", Year: 2017, Resolution: "2160p", Source: "Remux", VideoCodec: "H.265",
+			Atmos: true, HDR: []string{"HDR"}, Group: "EPSiLON",
+		}},
+		{"2001.A.Space.Odyssey.1968.1080p.BluRay.x264-AMIABLE", models.ReleaseInfo{
+			Title: "2001 A Space Odyssey", Year: 1968, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264",
+			Group: "AMIABLE",
+		}},
+		{"1917.2019.720p.WEB-DL.DDP5.1.H.264-NTG", models.ReleaseInfo{
+			Title: "1917", Year: 2019, Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264",
+			AudioCodec: "DD+", AudioChannels: "5.1", Group: "NTG",
+		}},
+		{"1917.1080p.BluRay.x264-GRP", models.ReleaseInfo{
+			Title: "1917", Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP",
+		}},
+
+		// Space and underscore separators
+		{"Blade Runner 2049 (2017) [1080p] [YTS.MX]", models.ReleaseInfo{
+			Title: "Blade Runner 2049", Year: 2017, Resolution: "1080p",
+		}},
+		{"Movie Name 2019 1080p WEB-DL", models.ReleaseInfo{
+			Title: "Movie Name", Year: 2019, Resolution: "1080p", Source: "WEB-DL",
+		}},
+		{"Dune_Part_Two_2024_2160p_WEB-DL_DV_HDR10+_DDP5.1_Atmos_H.265-FLUX", models.ReleaseInfo{
+			Title: "Dune Part Two", Year: 2024, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265",
+			AudioCodec: "DD+", AudioChannels: "5.1", Atmos: true, HDR: []string{"DV", "HDR10+"}, Group: "FLUX",
+		}},
+		{"the_godfather_1972_720p_dvdrip_xvid_ac3", models.ReleaseInfo{
+			Title: "the godfather", Year: 1972, Resolution: "720p", Source: "DVDRip", VideoCodec: "XviD",
+			AudioCodec: "DD",
+		}},
+
+		// No year
+		{"Some.Movie.Without.Year.1080p.WEBRip.x264-GRP", models.ReleaseInfo{
+			Title: "Some Movie Without Year", Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264", Group: "GRP",
+		}},
+		{"Arrival 1080p BluRay", models.ReleaseInfo{
+			Title: "Arrival", Resolution: "1080p", Source: "BluRay",
+		}},
+		{"Home Movies", models.ReleaseInfo{Title: "Home Movies"}},
+
+		// Episodes
+		{"Breaking.Bad.S05E14.720p.HDTV.x264-IMMERSE", models.ReleaseInfo{
+			Title: "Breaking Bad", Seasons: []int{5}, Episodes: []int{14}, Resolution: "720p", Source: "HDTV",
+			VideoCodec: "H.264", Group: "IMMERSE",
+		}},
+		{"Game.of.Thrones.S08E01E02.1080p.AMZN.WEB-DL.DDP5.1.H.264-GoT", models.ReleaseInfo{
+			Title: "Game of Thrones", Seasons: []int{8}, Episodes: []int{1, 2}, Resolution: "1080p", Source: "WEB-DL",
+			VideoCodec: "H.264", AudioCodec: "DD+", AudioChannels: "5.1", Group: "GoT",
+		}},
+		{"Show.S01E01-E03.1080p.WEB.H264-GRP", models.ReleaseInfo{
+			Title: "Show", Seasons: []int{1}, Episodes: []int{1, 2, 3}, Resolution: "1080p", Source: "WEB-DL",
+			VideoCodec: "H.264", Group: "GRP",
+		}},
+		{"Show.S01E05-06.720p", models.ReleaseInfo{
+			Title: "Show", Seasons: []int{1}, Episodes: []int{5, 6}, Resolution: "720p",
+		}},
+		{"Stranger.Things.S04E01.Chapter.One.2160p.NF.WEB-DL.DDP5.1.Atmos.HDR.HEVC-TEPES", models.ReleaseInfo{
+			Title: "Stranger Things", Seasons: []int{4}, Episodes: []int{1}, Resolution: "2160p", Source: "WEB-DL",
+			VideoCodec: "H.265", AudioCodec: "DD+", AudioChannels: "5.1", Atmos: true, HDR: []string{"HDR"}, Group: "TEPES",
+		}},
+		{"The.Flash.2014.S01E01.720p.HDTV.x264-LOL", models.ReleaseInfo{
+			Title: "The Flash", Year: 2014, Seasons: []int{1}, Episodes: []int{1}, Resolution: "720p", Source: "HDTV",
+			VideoCodec: "H.264", Group: "LOL",
+		}},
+		{"Doctor Who (2005) - S13E01 - The Halloween Apocalypse (1080p)", models.ReleaseInfo{
+			Title: "Doctor Who", Year: 2005, Seasons: []int{13}, Episodes: []int{1}, Resolution: "1080p",
+		}},
+		{"show_name_s02e03_720p_web_x264", models.ReleaseInfo{
+			Title: "show name", Seasons: []int{2}, Episodes: []int{3}, Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264",
+		}},
+		{"The Expanse 2x05 HDTV XviD-LOL", models.ReleaseInfo{
+			Title: "The Expanse", Seasons: []int{2}, Episodes: []int{5}, Source: "HDTV", VideoCodec: "XviD", Group: "LOL",
+		}},
+		{"[SubsPlease] Jujutsu Kaisen - 24 (1080p) [ABCD1234].mkv", models.ReleaseInfo{
+			Title: "Jujutsu Kaisen", Episodes: []int{24}, Resolution: "1080p", Group: "SubsPlease",
+		}},
+
+		// Season packs
+		{"The.Office.US.S03.1080p.BluRay.x265-RARBG", models.ReleaseInfo{
+			Title: "The Office US", Seasons: []int{3}, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.265", Group: "RARBG",
+		}},
+		{"Friends.S01-S10.COMPLETE.1080p.BluRay.x264-GROUP", models.ReleaseInfo{
+			Title: "Friends", Seasons: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, Resolution: "1080p", Source: "BluRay",
+			VideoCodec: "H.264", Group: "GROUP",
+		}},
+		{"Show Name - Season 2 - 720p WEBRip", models.ReleaseInfo{
+			Title: "Show Name", Seasons: []int{2}, Resolution: "720p", Source: "WEBRip",
+		}},
+		{"Show.S02.Season.Pack.1080p", models.ReleaseInfo{
+			Title: "Show", Seasons: []int{2}, Resolution: "1080p",
+		}},
+		{"Show.Name.Season.1-3.1080p", models.ReleaseInfo{
+			Title: "Show Name", Seasons: []int{1, 2, 3}, Resolution: "1080p",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
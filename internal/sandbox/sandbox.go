@@ -0,0 +1,191 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxNameBytes is the longest file name most filesystems accept
+const maxNameBytes = 255
+
+// ErrOutside is returned for paths that would leave the root
+var ErrOutside = errors.New("path is outside the library")
+
+// illegalChars are not allowed in file names on Windows, and a few of them
+// cause trouble on SMB shares and macOS too
+const illegalChars = `<>:"/\|?*`
+
+// reservedNames cannot be used as file names on Windows, with or without
+// an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Root confines file operations to a directory. Every path built from user
+// input or from Real-Debrid goes through it before touching the disk.
+type Root struct {
+	path     string // As configured, cleaned and absolute
+	resolved string // With symlinks resolved
+}
+
+// New returns a sandbox rooted at path
+func New(path string) *Root {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		resolved = abs
+	}
+
+	return &Root{path: abs, resolved: resolved}
+}
+
+// Path returns the root directory
+func (r *Root) Path() string {
+	return r.path
+}
+
+// Resolve turns a relative path supplied by a user into an absolute path
+// inside the root. Paths that climb out of the root, directly or through a
+// symlink, are rejected.
+func (r *Root) Resolve(rel string) (string, error) {
+	rel = filepath.ToSlash(rel)
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".." {
+			return "", ErrOutside
+		}
+	}
+
+	full := filepath.Join(r.path, filepath.FromSlash(rel))
+	if err := r.check(full); err != nil {
+		return "", err
+	}
+	return full, nil
+}
+
+// Join builds a path inside the root from names that came from elsewhere,
+// such as a torrent name or a file path within a torrent. Each element may
+// contain separators. Every name is sanitized and traversal is dropped
+// rather than rejected, so the result is always usable.
+func (r *Root) Join(elems ...string) (string, error) {
+	parts := []string{r.path}
+	for _, elem := range elems {
+		for _, part := range strings.FieldsFunc(elem, isSeparator) {
+			if part == "." || part == ".." {
+				continue
+			}
+			if name := SanitizeName(part); name != "" {
+				parts = append(parts, name)
+			}
+		}
+	}
+
+	full := filepath.Join(parts...)
+	if err := r.check(full); err != nil {
+		return "", err
+	}
+	return full, nil
+}
+
+// check makes sure full stays inside the root once symlinks are followed.
+// The path does not need to exist yet; its deepest existing parent is
+// checked instead.
+func (r *Root) check(full string) error {
+	if !within(r.path, full) {
+		return ErrOutside
+	}
+
+	existing := full
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !within(r.resolved, filepath.Join(append([]string{resolved}, rest...)...)) {
+				return ErrOutside
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		rest = append([]string{filepath.Base(existing)}, rest...)
+		existing = parent
+	}
+}
+
+// SanitizeName makes a single file or folder name safe to create on common
+// filesystems. It returns "" if nothing usable is left.
+func SanitizeName(name string) string {
+	name = norm.NFC.String(strings.ToValidUTF8(name, ""))
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(illegalChars, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	// Windows drops trailing dots and spaces, which makes names collide
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "" || name == "." || name == ".." {
+		return ""
+	}
+
+	stem := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	if reservedNames[stem] {
+		name = "_" + name
+	}
+
+	return truncateName(name)
+}
+
+// truncateName shortens a name to maxNameBytes, keeping its extension
+func truncateName(name string) string {
+	if len(name) <= maxNameBytes {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxNameBytes/2 {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+
+	limit := maxNameBytes - len(ext)
+	for len(stem) > limit {
+		_, size := utf8.DecodeLastRuneInString(stem)
+		stem = stem[:len(stem)-size]
+	}
+	return strings.TrimRight(stem, ". ") + ext
+}
+
+func isSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// within reports whether path is root or below it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
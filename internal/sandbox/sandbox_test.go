@@ -0,0 +1,221 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testRoot creates data/movies inside a temporary directory, along with a
+// sibling data/movies2 and a link from the library to the sibling
+func testRoot(t *testing.T) (*Root, string) {
+	data := t.TempDir()
+	movies := filepath.Join(data, "movies")
+	for _, dir := range []string{filepath.Join(movies, "Existing"), filepath.Join(data, "movies2")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(filepath.Join(data, "movies2"), filepath.Join(movies, "escape")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(movies, "Existing"), filepath.Join(movies, "inside")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(movies), data
+}
+
+func TestResolve(t *testing.T) {
+	root, data := testRoot(t)
+	movies := filepath.Join(data, "movies")
+
+	tests := []struct {
+		name    string
+		rel     string
+		want    string // Relative to the root, when allowed
+		outside bool
+		symlink bool // Needs the symlinks made by testRoot
+	}{
+		{name: "file", rel: "Movie.mkv", want: "Movie.mkv"},
+		{name: "nested", rel: "Existing/New/Movie.mkv", want: "Existing/New/Movie.mkv"},
+		{name: "root", rel: "", want: "."},
+		{name: "dot", rel: "./Existing/./Movie.mkv", want: "Existing/Movie.mkv"},
+		{name: "parent", rel: "..", outside: true},
+		{name: "traversal", rel: "../movies2/secret.txt", outside: true},
+		{name: "traversal inside", rel: "Existing/../Movie.mkv", outside: true},
+		{name: "deep traversal", rel: "Existing/../../../../etc/passwd", outside: true},
+		{name: "backslash traversal", rel: `..\movies2\secret.txt`, outside: runtime.GOOS == "windows", want: `..\movies2\secret.txt`},
+		{name: "absolute", rel: "/etc/passwd", want: "etc/passwd"},
+		{name: "symlink out", rel: "escape/secret.txt", outside: true, symlink: true},
+		{name: "symlink out to new path", rel: "escape/new/dir/file.mkv", outside: true, symlink: true},
+		{name: "symlink itself out", rel: "escape", outside: true, symlink: true},
+		{name: "symlink within", rel: "inside/Movie.mkv", want: "inside/Movie.mkv", symlink: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.symlink && runtime.GOOS == "windows" {
+				t.Skip("symlinks need privileges on Windows")
+			}
+			got, err := root.Resolve(tt.rel)
+			if tt.outside {
+				if !errors.Is(err, ErrOutside) {
+					t.Fatalf("Resolve(%q) = %q, %v, want ErrOutside", tt.rel, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q): %v", tt.rel, err)
+			}
+			if want := filepath.Join(movies, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.rel, got, want)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	root, data := testRoot(t)
+	movies := filepath.Join(data, "movies")
+
+	tests := []struct {
+		name    string
+		elems   []string
+		want    string
+		outside bool
+		symlink bool
+	}{
+		{name: "torrent file", elems: []string{"Movie.2020", "Movie.2020.mkv"}, want: "Movie.2020/Movie.2020.mkv"},
+		{name: "nested path", elems: []string{"Show", "Season 1/Show.S01E01.mkv"}, want: "Show/Season 1/Show.S01E01.mkv"},
+		{name: "traversal dropped", elems: []string{"../../etc", "passwd"}, want: "etc/passwd"},
+		{name: "backslash traversal dropped", elems: []string{`..\..\etc\passwd`}, want: "etc/passwd"},
+		{name: "absolute", elems: []string{"/etc/passwd"}, want: "etc/passwd"},
+		{name: "sanitized", elems: []string{"Movie: Part 1?", "CON.mkv"}, want: "Movie_ Part 1_/_CON.mkv"},
+		{name: "empty names dropped", elems: []string{"...", " ", "Movie.mkv"}, want: "Movie.mkv"},
+		{name: "symlink out", elems: []string{"escape", "Movie.mkv"}, outside: true, symlink: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.symlink && runtime.GOOS == "windows" {
+				t.Skip("symlinks need privileges on Windows")
+			}
+			got, err := root.Join(tt.elems...)
+			if tt.outside {
+				if !errors.Is(err, ErrOutside) {
+					t.Fatalf("Join(%q) = %q, %v, want ErrOutside", tt.elems, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Join(%q): %v", tt.elems, err)
+			}
+			if want := filepath.Join(movies, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("Join(%q) = %q, want %q", tt.elems, got, want)
+			}
+		})
+	}
+}
+
+func TestSiblingPrefix(t *testing.T) {
+	_, data := testRoot(t)
+	root := New(filepath.Join(data, "movies"))
+
+	// movies2 starts with the root's path but is not inside it
+	sibling := filepath.Join(data, "movies2", "Movie.mkv")
+	if err := root.check(sibling); !errors.Is(err, ErrOutside) {
+		t.Errorf("check(%q) = %v, want ErrOutside", sibling, err)
+	}
+	if within(filepath.Join(data, "movies"), sibling) {
+		t.Errorf("within reports %q inside the root", sibling)
+	}
+	if _, err := root.Resolve("../movies2/Movie.mkv"); !errors.Is(err, ErrOutside) {
+		t.Errorf("Resolve into the sibling = %v, want ErrOutside", err)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	root := filepath.FromSlash("/data/movies")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/data/movies", true},
+		{"/data/movies/Movie.mkv", true},
+		{"/data/movies/..movie/Movie.mkv", true},
+		{"/data/movies2", false},
+		{"/data/movies2/Movie.mkv", false},
+		{"/data/movie", false},
+		{"/data", false},
+		{"/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		path := filepath.FromSlash(tt.path)
+		if got := within(root, path); got != tt.want {
+			t.Errorf("within(%q, %q) = %v, want %v", root, path, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Movie.2020.1080p.mkv", "Movie.2020.1080p.mkv"},
+		{`Movie: The "Sequel"?.mkv`, "Movie_ The _Sequel__.mkv"},
+		{`a<b>c|d*e`, "a_b_c_d_e"},
+		{`dir/file\name`, "dir_file_name"},
+		{"tab\there\x00null\x1bescape", "tab_here_null_escape"},
+		{"CON", "_CON"},
+		{"con.txt", "_con.txt"},
+		{"Nul.mkv", "_Nul.mkv"},
+		{"COM1.srt", "_COM1.srt"},
+		{"LPT9", "_LPT9"},
+		{"CONSOLE.mkv", "CONSOLE.mkv"},
+		{"COM10.mkv", "COM10.mkv"},
+		{"trailing dots...", "trailing dots"},
+		{"  spaced  ", "spaced"},
+		{".", ""},
+		{"..", ""},
+		{"...", ""},
+		{"   ", ""},
+		{"", ""},
+		{"bad\xffutf8.mkv", "badutf8.mkv"},
+		{"Ame\u0301lie.mkv", "Am\u00e9lie.mkv"}, // Decomposed accent normalized to NFC
+		{".hidden", ".hidden"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeName(tt.name); got != tt.want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeNameTruncates(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantExt string
+	}{
+		{strings.Repeat("a", 300) + ".mkv", ".mkv"},
+		{strings.Repeat("é", 200) + ".srt", ".srt"}, // Two bytes each, cut on a rune boundary
+		{strings.Repeat("b", 300), ""},
+	}
+	for _, tt := range tests {
+		got := SanitizeName(tt.name)
+		if len(got) > maxNameBytes {
+			t.Errorf("SanitizeName kept %d bytes, want at most %d", len(got), maxNameBytes)
+		}
+		if !strings.HasSuffix(got, tt.wantExt) {
+			t.Errorf("SanitizeName(%q...) = %q, lost extension %q", tt.name[:10], got, tt.wantExt)
+		}
+		if !strings.HasPrefix(tt.name, strings.TrimSuffix(got, tt.wantExt)) {
+			t.Errorf("SanitizeName(%q...) = %q, not a prefix of the name", tt.name[:10], got)
+		}
+	}
+}
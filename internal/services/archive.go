@@ -0,0 +1,96 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stat returns details of a file or folder of a library
+func (s *MovieService) Stat(library, relativePath string) (os.FileInfo, error) {
+	fullPath, err := s.resolve(library, relativePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	return info, nil
+}
+
+// WriteArchive writes a folder of a library to w as a ZIP archive, with
+// the folder at its top. Files are stored without compression, since
+// video doesn't compress, and are copied one at a time so memory use stays
+// flat whatever the folder's size. Only regular files are included;
+// symlinks are skipped so nothing outside the library can be reached, and
+// unfinished downloads are left out.
+func (s *MovieService) WriteArchive(w io.Writer, library, relativePath string) error {
+	fullPath, err := s.resolve(library, relativePath)
+	if err != nil {
+		return err
+	}
+	base := filepath.Dir(fullPath)
+
+	zw := zip.NewWriter(w)
+	err = filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() && !d.IsDir() {
+			return nil
+		}
+		// Downloads in progress aren't listed, so they aren't archived either
+		if !d.IsDir() && isPartial(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(base, path)
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Store
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFile(dst, path)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// isPartial reports whether a file is an unfinished download, Movie.mkv.part,
+// or the segment progress kept beside one, Movie.mkv.part.state
+func isPartial(name string) bool {
+	return strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".part.state")
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
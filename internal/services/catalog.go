@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/probe"
+	"github.com/ygncode/real-debrid-downloader/internal/storage"
+)
+
+// CatalogService keeps an index of the libraries in the database, so the
+// collection can be listed without walking the disk. Periodic scans only
+// write the files whose size or modification time changed; downloads and
+// deletes refresh just the entry they touched. Video files are probed for
+// their stream details when they are first seen or change.
+type CatalogService struct {
+	repo      *storage.Repository
+	libraries *Libraries
+	interval  time.Duration // Between full scans, 0 to only scan at startup
+
+	scanMu sync.Mutex // Scans of the same files must not interleave
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewCatalogService(repo *storage.Repository, libraries *Libraries, interval time.Duration) *CatalogService {
+	return &CatalogService{
+		repo:      repo,
+		libraries: libraries,
+		interval:  interval,
+	}
+}
+
+// Start scans every library in the background, then again at each interval
+func (s *CatalogService) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	var names []string
+	for _, lib := range s.libraries.List() {
+		names = append(names, lib.Name)
+	}
+	if err := s.repo.DeleteLibrariesExcept(names); err != nil {
+		log.Printf("Failed to drop removed libraries from the catalog: %v", err)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.ScanAll()
+
+		if s.interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.ScanAll()
+			}
+		}
+	}()
+}
+
+func (s *CatalogService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// ScanAll brings the catalog of every library up to date
+func (s *CatalogService) ScanAll() {
+	for _, lib := range s.libraries.List() {
+		start := time.Now()
+		changed, err := s.scan(lib.Name, lib.Path, "")
+		if err != nil {
+			log.Printf("Failed to scan library %s: %v", lib.Name, err)
+			continue
+		}
+		if changed > 0 {
+			log.Printf("Scanned library %s: %d changes in %s", lib.Name, changed, time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
+
+// Refresh rescans the top level entries of a library that hold paths,
+// which may be absolute or relative to the library. It is called after
+// files are added, moved or deleted so the collection reflects them right
+// away.
+func (s *CatalogService) Refresh(library string, paths ...string) {
+	root, err := s.libraries.Root(library)
+	if err != nil {
+		log.Printf("Not refreshing catalog: %v", err)
+		return
+	}
+	if library == "" {
+		library = s.libraries.Default()
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		rel := path
+		if filepath.IsAbs(path) {
+			if rel, err = filepath.Rel(root.Path(), path); err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+		}
+		entry := topLevel(rel)
+		if entry == "" || entry == "." || entry == models.TrashDir || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+
+		if _, err := s.scan(library, root.Path(), entry); err != nil {
+			log.Printf("Failed to refresh %s in library %s: %v", entry, library, err)
+		}
+	}
+}
+
+// QueryEntries returns up to limit cataloged entries of a library that
+// match the query, starting after the cursor
+func (s *CatalogService) QueryEntries(library string, q models.MovieQuery, after *storage.EntryCursor, limit int) ([]models.LibraryEntry, error) {
+	return s.repo.QueryLibraryEntries(library, q, after, limit)
+}
+
+// scan compares the files under a library, or under one of its top level
+// entries, with the catalog and writes the differences, then probes the
+// videos it found new or changed. It returns how many files changed.
+func (s *CatalogService) scan(library, libraryPath, entry string) (int, error) {
+	changed, pending, err := s.compare(library, libraryPath, entry)
+	if err != nil {
+		return 0, err
+	}
+	s.probe(library, libraryPath, pending)
+	return changed, nil
+}
+
+// compare writes the differences between the disk and the catalog. Videos
+// are saved unprobed and returned, to be probed once scanMu is released:
+// the first scan of a large library would otherwise hold it for minutes and
+// keep finished downloads from showing up.
+func (s *CatalogService) compare(library, libraryPath, entry string) (int, []models.LibraryFile, error) {
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+
+	known, err := s.repo.GetLibraryFiles(library, entry)
+	if err != nil {
+		return 0, nil, err
+	}
+	previous := make(map[string]models.LibraryFile, len(known))
+	for _, f := range known {
+		previous[f.Path] = f
+	}
+
+	changes := storage.CatalogChanges{Library: library}
+	current := make(map[string][]models.LibraryFile) // By entry
+	dirty := make(map[string]bool)                   // Entries to recompute
+	var pending []models.LibraryFile                 // Videos to probe
+
+	walkRoot := libraryPath
+	if entry != "" {
+		walkRoot = filepath.Join(libraryPath, entry)
+		dirty[entry] = true
+	}
+
+	err = filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip files we can't access
+		}
+		if d.IsDir() {
+			if path == filepath.Join(libraryPath, models.TrashDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(libraryPath, path)
+		file := models.LibraryFile{
+			Library: library,
+			Path:    rel,
+			Entry:   topLevel(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if isMediaFile(path) {
+			file.FileType = getFileType(path)
+		}
+
+		old, ok := previous[rel]
+		delete(previous, rel)
+		changed := !ok || old.Size != file.Size || !old.ModTime.Equal(file.ModTime) || old.Entry != file.Entry
+		if !changed {
+			file.Media, file.Probed = old.Media, old.Probed
+		}
+		if file.FileType == "video" && !file.Probed {
+			pending = append(pending, file)
+		}
+		current[file.Entry] = append(current[file.Entry], file)
+
+		if changed {
+			changes.SaveFiles = append(changes.SaveFiles, file)
+			dirty[file.Entry] = true
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, nil, err
+	}
+
+	// Whatever was not seen is gone
+	for path, f := range previous {
+		changes.DeleteFiles = append(changes.DeleteFiles, path)
+		dirty[f.Entry] = true
+	}
+
+	for name := range dirty {
+		if e, ok := buildEntry(library, libraryPath, name, current[name]); ok {
+			changes.SaveEntries = append(changes.SaveEntries, e)
+		} else {
+			changes.DeleteEntries = append(changes.DeleteEntries, name)
+		}
+	}
+
+	if len(changes.SaveFiles)+len(changes.DeleteFiles)+len(changes.SaveEntries)+len(changes.DeleteEntries) == 0 {
+		return 0, pending, nil
+	}
+	if err := s.repo.ApplyCatalogChanges(changes); err != nil {
+		return 0, nil, err
+	}
+	return len(changes.SaveFiles) + len(changes.DeleteFiles), pending, nil
+}
+
+// probe reads the stream details of videos without holding scanMu, then
+// saves them one entry at a time
+func (s *CatalogService) probe(library, libraryPath string, pending []models.LibraryFile) {
+	var order []string
+	byEntry := make(map[string][]models.LibraryFile)
+	for _, f := range pending {
+		if _, ok := byEntry[f.Entry]; !ok {
+			order = append(order, f.Entry)
+		}
+		byEntry[f.Entry] = append(byEntry[f.Entry], f)
+	}
+
+	for _, name := range order {
+		files := byEntry[name]
+		for i := range files {
+			files[i].Media = probeFile(filepath.Join(libraryPath, files[i].Path))
+		}
+		if err := s.saveProbes(library, libraryPath, name, files); err != nil {
+			log.Printf("Failed to save stream details of %s in library %s: %v", name, library, err)
+		}
+	}
+}
+
+// saveProbes stores the stream details of probed files in the catalog and
+// updates their entry. Files that changed while they were probed are left
+// for the next scan.
+func (s *CatalogService) saveProbes(library, libraryPath, entry string, probed []models.LibraryFile) error {
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+
+	files, err := s.repo.GetLibraryFiles(library, entry)
+	if err != nil {
+		return err
+	}
+	byPath := make(map[string]models.LibraryFile, len(probed))
+	for _, f := range probed {
+		byPath[f.Path] = f
+	}
+
+	changes := storage.CatalogChanges{Library: library}
+	for i, f := range files {
+		p, ok := byPath[f.Path]
+		if !ok || f.Probed || f.Size != p.Size || !f.ModTime.Equal(p.ModTime) {
+			continue
+		}
+		files[i].ID = 0 // Saved by library and path, like a scan's files
+		files[i].Media, files[i].Probed = p.Media, true
+		changes.SaveFiles = append(changes.SaveFiles, files[i])
+	}
+	if len(changes.SaveFiles) == 0 {
+		return nil
+	}
+	if e, ok := buildEntry(library, libraryPath, entry, files); ok {
+		changes.SaveEntries = append(changes.SaveEntries, e)
+	}
+	return s.repo.ApplyCatalogChanges(changes)
+}
+
+// buildEntry summarises the files of a top level entry. Folders only count
+// when they hold media files, and loose files only when they are media.
+func buildEntry(library, libraryPath, name string, files []models.LibraryFile) (models.LibraryEntry, bool) {
+	info, err := os.Stat(filepath.Join(libraryPath, name))
+	if err != nil {
+		return models.LibraryEntry{}, false
+	}
+
+	entry := models.LibraryEntry{
+		Library:  library,
+		Path:     name,
+		Name:     filepath.Base(name),
+		IsFolder: info.IsDir(),
+		ModTime:  info.ModTime(),
+	}
+
+	hasMedia := false
+	var largest int64 = -1
+	for _, f := range files {
+		entry.Size += f.Size
+		switch f.FileType {
+		case "video":
+			entry.Videos++
+			if f.Size > largest {
+				entry.Media, largest = f.Media, f.Size
+			}
+		case "subtitle":
+			entry.Subtitles++
+		}
+		if f.FileType != "" {
+			hasMedia = true
+		}
+	}
+	if !entry.IsFolder && len(files) == 1 {
+		entry.FileType = files[0].FileType
+		entry.Stem = strings.TrimSuffix(entry.Name, filepath.Ext(entry.Name))
+	}
+
+	return entry, hasMedia
+}
+
+// probeFile reads the stream details of a video file, encoded for the
+// catalog. Files the probe can't read have none.
+func probeFile(path string) string {
+	info, err := probe.File(path)
+	if err != nil {
+		if !errors.Is(err, probe.ErrUnsupported) {
+			log.Printf("Failed to probe %s: %v", filepath.Base(path), err)
+		}
+		return ""
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// topLevel returns the first element of a relative path
+func topLevel(rel string) string {
+	rel = filepath.ToSlash(rel)
+	if i := strings.Index(rel, "/"); i >= 0 {
+		return rel[:i]
+	}
+	return rel
+}
@@ -1,16 +1,20 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ygncode/real-debrid-downloader/internal/models"
 	"github.com/ygncode/real-debrid-downloader/internal/realdebrid"
+	"github.com/ygncode/real-debrid-downloader/internal/release"
 	"github.com/ygncode/real-debrid-downloader/internal/storage"
 )
 
@@ -35,8 +39,22 @@ func NewDownloadService(
 	}
 }
 
+// AddOptions are the choices made for a single download when adding it
+type AddOptions struct {
+	DownloadSubs      bool
+	SubtitleLanguages []string               // Replaces the configured subtitle languages
+	Selection         *models.SelectionRules // Replaces the default file selection rules
+	Library           string                 // Library to download into, routed automatically if empty
+	Tag               string                 // Category tag that routing rules can match
+}
+
 // AddMagnet adds a magnet link and creates a download entry
-func (s *DownloadService) AddMagnet(ctx context.Context, magnetLink string, downloadSubs bool) (*models.Download, error) {
+func (s *DownloadService) AddMagnet(ctx context.Context, magnetLink string, opts AddOptions) (*models.Download, error) {
+	rulesJSON, err := encodeSelection(opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+
 	// Extract name from magnet link if possible
 	name := extractNameFromMagnet(magnetLink)
 	if name == "" {
@@ -51,13 +69,18 @@ func (s *DownloadService) AddMagnet(ctx context.Context, magnetLink string, down
 
 	// Create download entry
 	download := &models.Download{
-		TorrentID:    result.ID,
-		Name:         name,
-		Status:       models.StatusPending,
-		Progress:     0,
-		DownloadSubs: downloadSubs,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		TorrentID:      result.ID,
+		Name:           name,
+		Status:         models.StatusPending,
+		Progress:       0,
+		DownloadSubs:   opts.DownloadSubs,
+		SubtitleLangs:  strings.Join(opts.SubtitleLanguages, ","),
+		Magnet:         magnetLink,
+		SelectionRules: rulesJSON,
+		Library:        opts.Library,
+		Tag:            opts.Tag,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
 	}
 
 	if err := s.repo.CreateDownload(download); err != nil {
@@ -70,22 +93,39 @@ func (s *DownloadService) AddMagnet(ctx context.Context, magnetLink string, down
 }
 
 // AddTorrent uploads a .torrent file and creates a download entry
-func (s *DownloadService) AddTorrent(ctx context.Context, filename string, torrentData io.Reader, downloadSubs bool) (*models.Download, error) {
+func (s *DownloadService) AddTorrent(ctx context.Context, filename string, torrentData io.Reader, opts AddOptions) (*models.Download, error) {
+	rulesJSON, err := encodeSelection(opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the file so the torrent can be added again later
+	data, err := io.ReadAll(torrentData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read torrent file: %w", err)
+	}
+
 	// Add torrent to Real-Debrid
-	result, err := s.rdClient.AddTorrent(ctx, filename, torrentData)
+	result, err := s.rdClient.AddTorrent(ctx, filename, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to add torrent to Real-Debrid: %w", err)
 	}
 
 	// Create download entry
 	download := &models.Download{
-		TorrentID:    result.ID,
-		Name:         filename,
-		Status:       models.StatusPending,
-		Progress:     0,
-		DownloadSubs: downloadSubs,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		TorrentID:       result.ID,
+		Name:            filename,
+		Status:          models.StatusPending,
+		Progress:        0,
+		DownloadSubs:    opts.DownloadSubs,
+		SubtitleLangs:   strings.Join(opts.SubtitleLanguages, ","),
+		TorrentFilename: filename,
+		TorrentData:     data,
+		SelectionRules:  rulesJSON,
+		Library:         opts.Library,
+		Tag:             opts.Tag,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
 	}
 
 	if err := s.repo.CreateDownload(download); err != nil {
@@ -96,6 +136,29 @@ func (s *DownloadService) AddTorrent(ctx context.Context, filename string, torre
 	return download, nil
 }
 
+// parseRelease reads release details from a name, or returns nil while the
+// name is still a placeholder
+func parseRelease(name string) *models.ReleaseInfo {
+	if name == "" || name == "Processing..." {
+		return nil
+	}
+	info := release.Parse(name)
+	return &info
+}
+
+// encodeSelection validates per-download selection rules and encodes them
+// for storage
+func encodeSelection(selection *models.SelectionRules) (string, error) {
+	if selection == nil {
+		return "", nil
+	}
+	if err := selection.Validate(); err != nil {
+		return "", fmt.Errorf("invalid selection rules: %w", err)
+	}
+	data, _ := json.Marshal(selection)
+	return string(data), nil
+}
+
 // SelectFiles selects which files to download from a torrent
 func (s *DownloadService) SelectFiles(ctx context.Context, downloadID uint, fileIDs string) error {
 	download, err := s.repo.GetDownload(downloadID)
@@ -126,12 +189,104 @@ func (s *DownloadService) SelectFiles(ctx context.Context, downloadID uint, file
 
 // GetDownload retrieves a download by ID
 func (s *DownloadService) GetDownload(id uint) (*models.Download, error) {
-	return s.repo.GetDownload(id)
+	download, err := s.repo.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	download.Release = parseRelease(download.Name)
+	return download, nil
 }
 
-// GetAllDownloads retrieves all downloads
+// GetAllDownloads retrieves all downloads along with their queue positions
 func (s *DownloadService) GetAllDownloads() ([]models.Download, error) {
-	return s.repo.GetAllDownloads()
+	downloads, err := s.repo.GetAllDownloads()
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := s.repo.GetQueuePositions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range downloads {
+		downloads[i].QueuePosition = positions[downloads[i].ID]
+		downloads[i].Release = parseRelease(downloads[i].Name)
+	}
+
+	return downloads, nil
+}
+
+// GetQueuedDownloads returns the downloads waiting for a worker, in the
+// order they will be picked up
+func (s *DownloadService) GetQueuedDownloads() ([]models.Download, error) {
+	downloads, err := s.GetAllDownloads()
+	if err != nil {
+		return nil, err
+	}
+
+	var queued []models.Download
+	for _, d := range downloads {
+		if d.QueuePosition > 0 {
+			queued = append(queued, d)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].QueuePosition < queued[j].QueuePosition
+	})
+
+	return queued, nil
+}
+
+// MoveDownload changes where a download sits in the queue. The target is
+// "top" or "bottom", or a 1-based position among queued downloads.
+func (s *DownloadService) MoveDownload(id uint, to string, position int) error {
+	download, err := s.repo.GetDownload(id)
+	if err != nil {
+		return fmt.Errorf("download not found: %w", err)
+	}
+
+	switch to {
+	case "top", "bottom":
+		lowest, highest, err := s.repo.GetPriorityRange()
+		if err != nil {
+			return fmt.Errorf("failed to read priorities: %w", err)
+		}
+
+		priority := highest + 1
+		if to == "bottom" {
+			priority = lowest - 1
+		}
+		return s.repo.UpdateDownloadPriority(download.ID, priority)
+
+	case "", "position":
+		ids, err := s.repo.GetQueuedDownloadIDs()
+		if err != nil {
+			return fmt.Errorf("failed to read queue: %w", err)
+		}
+
+		order := make([]uint, 0, len(ids))
+		for _, queuedID := range ids {
+			if queuedID != download.ID {
+				order = append(order, queuedID)
+			}
+		}
+		if len(order) == len(ids) {
+			return fmt.Errorf("download is not queued")
+		}
+
+		if position < 1 {
+			return fmt.Errorf("position must be at least 1")
+		}
+		if position > len(ids) {
+			position = len(ids)
+		}
+
+		order = append(order[:position-1], append([]uint{download.ID}, order[position-1:]...)...)
+		return s.repo.ReorderDownloads(order)
+
+	default:
+		return fmt.Errorf("invalid move target: %s", to)
+	}
 }
 
 // GetDownloadFiles returns the files available for selection
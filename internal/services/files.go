@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/sandbox"
+)
+
+// Rename gives a file or folder of a library a new name in the same
+// folder. Subtitles named after a renamed video, such as Movie.srt and
+// Movie.en.srt, are renamed with it. A file keeps its extension when the
+// new name has none. It returns the new relative path.
+func (s *MovieService) Rename(library, relativePath, newName string) (string, error) {
+	if strings.ContainsAny(newName, `/\`) {
+		return "", fmt.Errorf("name must not contain slashes")
+	}
+	name := sandbox.SanitizeName(strings.TrimSpace(newName))
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid name")
+	}
+
+	fullPath, err := s.resolve(library, relativePath)
+	if err != nil {
+		return "", err
+	}
+	// Keep the extension of a file when the new name leaves it out
+	if info, err := os.Lstat(fullPath); err == nil && !info.IsDir() && filepath.Ext(name) == "" {
+		name += filepath.Ext(fullPath)
+	}
+	return s.relocate(library, fullPath, filepath.Join(filepath.Dir(fullPath), name))
+}
+
+// Move moves a file or folder of a library into another folder of the same
+// library, creating it if needed. An empty folder means the top of the
+// library. Subtitles follow a moved video. It returns the new relative path.
+func (s *MovieService) Move(library, relativePath, folder string) (string, error) {
+	fullPath, err := s.resolve(library, relativePath)
+	if err != nil {
+		return "", err
+	}
+
+	root, _ := s.libraries.Root(library)
+	destDir := root.Path()
+	if strings.Trim(folder, `/\. `) != "" {
+		if destDir, err = s.resolve(library, folder); err != nil {
+			return "", err
+		}
+	}
+	if destDir == fullPath || strings.HasPrefix(destDir, fullPath+string(filepath.Separator)) {
+		return "", fmt.Errorf("can't move a folder into itself")
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	return s.relocate(library, fullPath, filepath.Join(destDir, filepath.Base(fullPath)))
+}
+
+// CreateFolder creates a folder, and any missing parents, in a library
+func (s *MovieService) CreateFolder(library, relativePath string) (string, error) {
+	root, err := s.libraries.Root(library)
+	if err != nil {
+		return "", err
+	}
+	for _, part := range strings.FieldsFunc(relativePath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return "", sandbox.ErrOutside
+		}
+	}
+	// Each name is cleaned the way downloaded names are
+	fullPath, err := root.Join(relativePath)
+	if err != nil || fullPath == root.Path() {
+		return "", fmt.Errorf("invalid path")
+	}
+	rel, _ := filepath.Rel(root.Path(), fullPath)
+	if topLevel(rel) == models.TrashDir {
+		return "", fmt.Errorf("invalid path")
+	}
+
+	if _, err := os.Lstat(fullPath); err == nil {
+		return "", fmt.Errorf("%s: %w", filepath.ToSlash(rel), fs.ErrExist)
+	}
+	if err := os.MkdirAll(fullPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	log.Printf("Created folder %s in library %s", rel, s.libraryName(library))
+	s.catalog.Refresh(library, fullPath)
+	return filepath.ToSlash(rel), nil
+}
+
+// relocate renames from to to, taking the subtitles of a video along.
+// Nothing is moved unless every target is free.
+func (s *MovieService) relocate(library, from, to string) (string, error) {
+	root, _ := s.libraries.Root(library)
+	rel := func(p string) string {
+		r, _ := filepath.Rel(root.Path(), p)
+		return filepath.ToSlash(r)
+	}
+
+	info, err := os.Lstat(from)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %w", err)
+	}
+	if from == to {
+		return rel(to), nil
+	}
+	// Renaming something to the trash's name at the top would hide it there
+	if topLevel(rel(to)) == models.TrashDir {
+		return "", fmt.Errorf("invalid name")
+	}
+
+	moves := [][2]string{{from, to}}
+	if !info.IsDir() && isVideo(from) {
+		oldStem := strings.TrimSuffix(filepath.Base(from), filepath.Ext(from))
+		newStem := strings.TrimSuffix(filepath.Base(to), filepath.Ext(to))
+		for _, sub := range subtitlesFor(from, nil) {
+			// Only subtitles named exactly after the video, not Movie 2.srt
+			suffix := strings.TrimPrefix(filepath.Base(sub), oldStem)
+			if !strings.HasPrefix(suffix, ".") {
+				continue
+			}
+			moves = append(moves, [2]string{sub, filepath.Join(filepath.Dir(to), newStem+suffix)})
+		}
+	}
+
+	// A case-only rename on a case-insensitive filesystem finds the source
+	// itself at the target, which is fine
+	for _, m := range moves {
+		if existing, err := os.Lstat(m[1]); err == nil {
+			if src, err := os.Lstat(m[0]); err != nil || !os.SameFile(src, existing) {
+				return "", fmt.Errorf("%s: %w", rel(m[1]), fs.ErrExist)
+			}
+		}
+	}
+
+	var touched []string
+	for i, m := range moves {
+		touched = append(touched, m[0], m[1])
+		if err := os.Rename(m[0], m[1]); err != nil {
+			if i == 0 {
+				return "", fmt.Errorf("failed to move %s: %w", rel(m[0]), err)
+			}
+			log.Printf("Failed to move subtitle %s: %v", rel(m[0]), err)
+			continue
+		}
+		log.Printf("Moved %s -> %s in library %s", rel(m[0]), rel(m[1]), s.libraryName(library))
+	}
+
+	s.catalog.Refresh(library, touched...)
+	return rel(to), nil
+}
+
+// libraryName resolves "" to the default library, for logging
+func (s *MovieService) libraryName(library string) string {
+	if library == "" {
+		return s.libraries.Default()
+	}
+	return library
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+func TestRenameRejectsTrashName(t *testing.T) {
+	dir := t.TempDir()
+	libraries := NewLibraries([]models.Library{{Name: "Movies", Path: dir}}, nil)
+	s := NewMovieService(libraries, nil, nil)
+
+	if err := os.MkdirAll(filepath.Join(dir, "Film", "Extras"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Film.mkv"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"Film", "Film.mkv"} {
+		if _, err := s.Rename("Movies", path, models.TrashDir); err == nil {
+			t.Errorf("Rename(%s, %s) succeeded", path, models.TrashDir)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("%s is gone after a refused rename: %v", path, err)
+		}
+	}
+	if _, err := s.Move("Movies", "Film/Extras", models.TrashDir); err == nil {
+		t.Errorf("Move into %s succeeded", models.TrashDir)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, models.TrashDir)); !os.IsNotExist(err) {
+		t.Errorf("%s was created: %v", models.TrashDir, err)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/release"
+	"github.com/ygncode/real-debrid-downloader/internal/sandbox"
+)
+
+// Libraries holds the named library roots and the rules that route
+// downloads between them. The first library is the default.
+type Libraries struct {
+	list   []models.Library
+	roots  map[string]*sandbox.Root
+	routes []models.RouteRule
+}
+
+func NewLibraries(libraries []models.Library, routes []models.RouteRule) *Libraries {
+	l := &Libraries{
+		list:   libraries,
+		roots:  make(map[string]*sandbox.Root, len(libraries)),
+		routes: routes,
+	}
+	for _, lib := range libraries {
+		l.roots[lib.Name] = sandbox.New(lib.Path)
+	}
+	return l
+}
+
+// List returns the libraries in the order they were configured
+func (l *Libraries) List() []models.Library {
+	return l.list
+}
+
+// Default returns the name of the library used when no rule matches
+func (l *Libraries) Default() string {
+	return l.list[0].Name
+}
+
+// Root returns the sandbox of a library, or of the default one for ""
+func (l *Libraries) Root(name string) (*sandbox.Root, error) {
+	if name == "" {
+		name = l.Default()
+	}
+	root, ok := l.roots[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown library %q", name)
+	}
+	return root, nil
+}
+
+// Route picks the library for a download: the one chosen when it was
+// added, otherwise the first matching routing rule, otherwise the default
+func (l *Libraries) Route(download *models.Download) string {
+	if download.Library != "" {
+		return download.Library
+	}
+
+	info := release.Parse(download.Name)
+	for _, rule := range l.routes {
+		if _, ok := l.roots[rule.Library]; ok && rule.Match(download.Name, download.Tag, info) {
+			return rule.Library
+		}
+	}
+	return l.Default()
+}
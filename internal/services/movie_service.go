@@ -1,13 +1,18 @@
 package services
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
 
 	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/storage"
+	"github.com/ygncode/real-debrid-downloader/internal/webvtt"
 )
 
 var videoExtensions = map[string]bool{
@@ -43,83 +48,121 @@ var mediaExtensions = map[string]bool{
 }
 
 type MovieService struct {
-	moviesPath string
+	libraries *Libraries
+	catalog   *CatalogService
+	trash     *TrashService
 }
 
-func NewMovieService(moviesPath string) *MovieService {
-	return &MovieService{moviesPath: moviesPath}
+func NewMovieService(libraries *Libraries, catalog *CatalogService, trash *TrashService) *MovieService {
+	return &MovieService{
+		libraries: libraries,
+		catalog:   catalog,
+		trash:     trash,
+	}
 }
 
-func (s *MovieService) ListMovies() ([]models.Movie, error) {
-	var movies []models.Movie
+// ListMovies lists the media in one library, or in every library when
+// library is "". Libraries are listed in order, newest files first.
+func (s *MovieService) ListMovies(library string) ([]models.Movie, error) {
+	movies, _, err := s.QueryMovies(models.MovieQuery{Library: library, Sort: models.SortDate, Desc: true})
+	return movies, err
+}
+
+// QueryMovies returns a page of the collection and the cursor of the next
+// page, which is "" on the last one
+func (s *MovieService) QueryMovies(q models.MovieQuery) ([]models.Movie, string, error) {
+	var names []string
+	if q.Library != "" {
+		if _, err := s.libraries.Root(q.Library); err != nil {
+			return nil, "", err
+		}
+		names = []string{q.Library}
+	} else {
+		for _, lib := range s.libraries.List() {
+			names = append(names, lib.Name)
+		}
+	}
+
+	var after *storage.EntryCursor
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		i := slices.Index(names, cursor.Library)
+		if i < 0 {
+			return nil, "", fmt.Errorf("invalid cursor")
+		}
+		names = names[i:]
+		after = cursor
+	}
 
-	err := filepath.Walk(s.moviesPath, func(path string, info os.FileInfo, err error) error {
+	var movies []models.Movie
+	for i, name := range names {
+		// Fetch one extra entry to find out whether the library has more
+		limit := 0
+		if q.Limit > 0 {
+			limit = q.Limit - len(movies) + 1
+		}
+		entries, err := s.catalog.QueryEntries(name, q, after, limit)
 		if err != nil {
-			return nil // Skip files we can't access
+			return nil, "", err
 		}
+		after = nil
 
-		// Skip the root directory itself
-		if path == s.moviesPath {
-			return nil
+		if limit > 0 && len(entries) == limit {
+			entries = entries[:limit-1]
+			movies = appendEntries(movies, entries)
+			return movies, encodeCursor(entryCursor(entries[len(entries)-1])), nil
 		}
+		movies = appendEntries(movies, entries)
 
-		// Get relative path from movies directory
-		relPath, _ := filepath.Rel(s.moviesPath, path)
-
-		if info.IsDir() {
-			// Check if directory contains any media files
-			hasMedia := false
-			filepath.Walk(path, func(subPath string, subInfo os.FileInfo, subErr error) error {
-				if subErr == nil && !subInfo.IsDir() && isMediaFile(subPath) {
-					hasMedia = true
-					return filepath.SkipDir
-				}
-				return nil
-			})
-
-			if hasMedia {
-				// Calculate total size of folder
-				var totalSize int64
-				filepath.Walk(path, func(subPath string, subInfo os.FileInfo, subErr error) error {
-					if subErr == nil && !subInfo.IsDir() {
-						totalSize += subInfo.Size()
-					}
-					return nil
-				})
-
-				movies = append(movies, models.Movie{
-					Name:     info.Name(),
-					Path:     relPath,
-					Size:     totalSize,
-					ModTime:  info.ModTime(),
-					IsFolder: true,
-				})
-				return filepath.SkipDir // Don't recurse into movie folders
-			}
-		} else if isMediaFile(path) {
-			movies = append(movies, models.Movie{
-				Name:     info.Name(),
-				Path:     relPath,
-				Size:     info.Size(),
-				ModTime:  info.ModTime(),
-				IsFolder: false,
-				FileType: getFileType(path),
-			})
+		if q.Limit > 0 && len(movies) == q.Limit && i+1 < len(names) {
+			// The page ends with this library, so the next starts at the top
+			// of the following one
+			return movies, encodeCursor(&storage.EntryCursor{Library: names[i+1]}), nil
 		}
+	}
+	return movies, "", nil
+}
 
-		return nil
-	})
+func appendEntries(movies []models.Movie, entries []models.LibraryEntry) []models.Movie {
+	for _, entry := range entries {
+		movie := entry.Movie()
+		if movie.IsFolder || movie.FileType == "video" {
+			movie.Release = parseRelease(movie.Name)
+		}
+		movies = append(movies, movie)
+	}
+	return movies
+}
 
-	if err != nil {
-		return nil, err
+func entryCursor(entry models.LibraryEntry) *storage.EntryCursor {
+	return &storage.EntryCursor{
+		Library: entry.Library,
+		ID:      entry.ID,
+		Name:    entry.Name,
+		Size:    entry.Size,
+		ModTime: entry.ModTime,
 	}
+}
 
-	// Sort by modification time (newest first)
-	sort.Slice(movies, func(i, j int) bool {
-		return movies[i].ModTime.After(movies[j].ModTime)
-	})
+// Cursors are opaque to clients
+func encodeCursor(cursor *storage.EntryCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
 
-	return movies, nil
+func decodeCursor(s string) (*storage.EntryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor storage.EntryCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
 }
 
 func isVideo(path string) bool {
@@ -148,33 +191,144 @@ func getFileType(path string) string {
 	return "other"
 }
 
-func (s *MovieService) GetMoviesPath() string {
-	return s.moviesPath
+// Libraries returns the configured libraries
+func (s *MovieService) Libraries() []models.Library {
+	return s.libraries.List()
 }
 
-// DeleteFile deletes a file or folder from the movies directory
-func (s *MovieService) DeleteFile(relativePath string) error {
-	// Sanitize the path to prevent directory traversal
-	cleanPath := filepath.Clean(relativePath)
-	if strings.HasPrefix(cleanPath, "..") {
-		return fmt.Errorf("invalid path")
-	}
+// DeleteFile moves a file or folder of a library to its trash, from where
+// it can be restored. An empty library means the default one.
+func (s *MovieService) DeleteFile(library, relativePath string) error {
+	_, err := s.trash.Trash(library, relativePath)
+	return err
+}
 
-	fullPath := filepath.Join(s.moviesPath, cleanPath)
+// OpenFile opens a file of a library for reading. Folders and the trash
+// can't be opened.
+func (s *MovieService) OpenFile(library, relativePath string) (*os.File, os.FileInfo, error) {
+	fullPath, err := s.resolve(library, relativePath)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Verify the path is still within the movies directory
-	if !strings.HasPrefix(fullPath, s.moviesPath) {
-		return fmt.Errorf("invalid path")
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file not found: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
 	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is a folder", info.Name())
+	}
+	return f, info, nil
+}
 
-	// Check if file/folder exists
+// PlayableVideo returns the video to play for an item of the collection:
+// the file itself, or the largest video in a folder
+func (s *MovieService) PlayableVideo(library, relativePath string) (string, error) {
+	fullPath, err := s.resolve(library, relativePath)
+	if err != nil {
+		return "", err
+	}
 	info, err := os.Stat(fullPath)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return "", fmt.Errorf("file not found: %w", err)
 	}
 
-	if info.IsDir() {
-		return os.RemoveAll(fullPath)
+	video := ""
+	if !info.IsDir() {
+		if isVideo(fullPath) {
+			video = fullPath
+		}
+	} else {
+		var largest int64 = -1
+		filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !isVideo(path) {
+				return nil
+			}
+			if info, err := d.Info(); err == nil && info.Size() > largest {
+				video, largest = path, info.Size()
+			}
+			return nil
+		})
+	}
+	if video == "" {
+		return "", fmt.Errorf("no video to play in %s", info.Name())
+	}
+
+	root, _ := s.libraries.Root(library)
+	rel, _ := filepath.Rel(root.Path(), video)
+	return filepath.ToSlash(rel), nil
+}
+
+// SubtitleTracks lists the subtitles next to a video that can be shown in
+// the browser, such as Movie.srt or Movie.en.ass
+func (s *MovieService) SubtitleTracks(library, videoPath string) ([]models.SubtitleTrack, error) {
+	fullPath, err := s.resolve(library, videoPath)
+	if err != nil {
+		return nil, err
+	}
+	root, _ := s.libraries.Root(library)
+	stem := strings.TrimSuffix(filepath.Base(fullPath), filepath.Ext(fullPath))
+
+	var tracks []models.SubtitleTrack
+	for _, sub := range subtitlesFor(fullPath, nil) {
+		ext := filepath.Ext(sub)
+		if !webvtt.Supported(ext) {
+			continue
+		}
+		rel, _ := filepath.Rel(root.Path(), sub)
+		track := models.SubtitleTrack{Path: filepath.ToSlash(rel)}
+
+		// Whatever sits between the video's name and the extension, such
+		// as "en" or "en.forced", names the track
+		suffix := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(sub), stem), ext), ". _-")
+		for _, part := range strings.Split(suffix, ".") {
+			if isLanguageCode(part) {
+				track.Language = strings.ToLower(part)
+				break
+			}
+		}
+		track.Label = suffix
+		if track.Label == "" {
+			track.Label = strings.ToUpper(strings.TrimPrefix(ext, "."))
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// isLanguageCode reports whether s looks like an ISO 639 code such as en
+// or eng
+func isLanguageCode(s string) bool {
+	if len(s) < 2 || len(s) > 3 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve turns a path from a request into an absolute path inside a
+// library. The library itself and its trash are off limits.
+func (s *MovieService) resolve(library, relativePath string) (string, error) {
+	root, err := s.libraries.Root(library)
+	if err != nil {
+		return "", err
+	}
+	fullPath, err := root.Resolve(relativePath)
+	if err != nil || fullPath == root.Path() {
+		return "", fmt.Errorf("invalid path")
+	}
+	if rel, _ := filepath.Rel(root.Path(), fullPath); topLevel(rel) == models.TrashDir {
+		return "", fmt.Errorf("invalid path")
 	}
-	return os.Remove(fullPath)
+	return fullPath, nil
 }
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/opensubtitles"
+	"github.com/ygncode/real-debrid-downloader/internal/release"
+)
+
+// OpenSubtitlesProvider fetches subtitles from the OpenSubtitles REST API.
+// It searches by the video's hash first, which finds subtitles timed for
+// that exact release, then by the title parsed from its name.
+type OpenSubtitlesProvider struct {
+	client *opensubtitles.Client
+}
+
+// NewOpenSubtitlesProvider uses client, or is unavailable when it is nil
+func NewOpenSubtitlesProvider(client *opensubtitles.Client) *OpenSubtitlesProvider {
+	return &OpenSubtitlesProvider{client: client}
+}
+
+func (p *OpenSubtitlesProvider) Name() string {
+	return "opensubtitles"
+}
+
+func (p *OpenSubtitlesProvider) Available() bool {
+	return p.client != nil
+}
+
+func (p *OpenSubtitlesProvider) Fetch(ctx context.Context, videoPath, language string) (string, error) {
+	if !p.Available() {
+		return "", fmt.Errorf("no OpenSubtitles API key")
+	}
+	languages := []string{language}
+
+	var results []models.SubtitleResult
+	if hash, err := opensubtitles.Hash(videoPath); err == nil {
+		found, err := p.client.Search(ctx, opensubtitles.SearchParams{MovieHash: hash, Languages: languages})
+		if err != nil {
+			// The title search may still work
+			log.Printf("OpenSubtitles hash search failed for %s: %v", filepath.Base(videoPath), err)
+		}
+		// Without an exact match the hash may still have named the movie,
+		// but the title search is as good then
+		for _, r := range found {
+			if r.Attributes.MovieHashMatch {
+				results = append(results, r)
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		params := titleSearch(videoPath)
+		if params.Query == "" {
+			return "", ErrNoSubtitles
+		}
+		params.Languages = languages
+		found, err := p.client.Search(ctx, params)
+		if err != nil {
+			return "", err
+		}
+		results = found
+	}
+
+	file := bestSubtitle(results)
+	if file == nil {
+		return "", ErrNoSubtitles
+	}
+	data, err := p.client.Download(ctx, file.FileID)
+	if err != nil {
+		return "", err
+	}
+
+	path := subtitlePath(videoPath, language)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save subtitles: %w", err)
+	}
+	return path, nil
+}
+
+// titleSearch builds a search from the video's release name, or from its
+// folder's when the file name is too loose to tell, as with 1080p.mkv in
+// Movie (2001)
+func titleSearch(videoPath string) opensubtitles.SearchParams {
+	info := release.Parse(filepath.Base(videoPath))
+	if info.Title == "" || (info.Year == 0 && !info.IsSeries()) {
+		if folder := release.Parse(filepath.Base(filepath.Dir(videoPath))); folder.Year != 0 || folder.IsSeries() {
+			info = folder
+		}
+	}
+
+	params := opensubtitles.SearchParams{Query: info.Title, Year: info.Year}
+	if len(info.Seasons) > 0 {
+		params.Season = info.Seasons[0]
+	}
+	if len(info.Episodes) > 0 {
+		params.Episode = info.Episodes[0]
+	}
+	return params
+}
+
+// bestSubtitle picks the file of the best result: an exact hash match,
+// then human translations, then the most downloaded
+func bestSubtitle(results []models.SubtitleResult) *models.SubtitleFile {
+	var candidates []models.SubtitleResult
+	for _, r := range results {
+		if len(r.Attributes.Files) > 0 {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].Attributes, candidates[j].Attributes
+		if a.MovieHashMatch != b.MovieHashMatch {
+			return a.MovieHashMatch
+		}
+		if a.MachineMade != b.MachineMade {
+			return !a.MachineMade
+		}
+		return a.DownloadCount > b.DownloadCount
+	})
+	return &candidates[0].Attributes.Files[0]
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/release"
+	"github.com/ygncode/real-debrid-downloader/internal/sandbox"
+)
+
+// NameData is what organizer naming templates can use
+type NameData struct {
+	Title        string
+	Year         int
+	Season       int
+	Episode      int    // First episode
+	EpisodeLabel string // S01E02, or S01E02-E03 for multi-episode files
+	Resolution   string
+	Source       string
+	VideoCodec   string
+	AudioCodec   string
+	HDR          string // Space separated, e.g. "DV HDR10"
+	Group        string
+	Proper       bool
+	Repack       bool
+}
+
+// Move is one file the organizer relocates
+type Move struct {
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+	Note string `json:"note,omitempty"` // Why the file stays where it is
+}
+
+// OrganizerService moves finished downloads into a clean library layout
+type OrganizerService struct {
+	movieTemplate   *template.Template
+	episodeTemplate *template.Template
+}
+
+func NewOrganizerService(movieTemplate, episodeTemplate string) (*OrganizerService, error) {
+	movieTmpl, err := template.New("movie").Parse(movieTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid movie template: %w", err)
+	}
+	episodeTmpl, err := template.New("episode").Parse(episodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid episode template: %w", err)
+	}
+
+	return &OrganizerService{
+		movieTemplate:   movieTmpl,
+		episodeTemplate: episodeTmpl,
+	}, nil
+}
+
+// Plan works out where the video files of a download and their subtitles
+// would go inside library, without touching the disk
+func (s *OrganizerService) Plan(library *sandbox.Root, download *models.Download) ([]Move, error) {
+	paths := downloadPaths(download)
+	fallback := release.Parse(download.Name)
+
+	var moves []Move
+	claimed := make(map[string]bool) // Targets taken by earlier moves
+	for _, path := range paths {
+		if !isVideo(path) || !fileExists(path) {
+			continue
+		}
+
+		name := filepath.Base(path)
+		if models.IsSample(filepath.Join(filepath.Base(filepath.Dir(path)), name)) {
+			moves = append(moves, Move{From: path, Note: "sample"})
+			continue
+		}
+
+		info := release.Parse(name)
+		if info.Year == 0 && !info.IsSeries() {
+			// Files inside a release folder are often named loosely
+			info = fallback
+		}
+		if info.IsSeries() && len(info.Episodes) == 0 {
+			moves = append(moves, Move{From: path, Note: "episode number not found"})
+			continue
+		}
+
+		target, err := s.target(library, info, filepath.Ext(path))
+		if err != nil {
+			return nil, err
+		}
+		if target == path {
+			continue
+		}
+		if claimed[target] || fileExists(target) {
+			moves = append(moves, Move{From: path, Note: "target already exists"})
+			continue
+		}
+		claimed[target] = true
+		moves = append(moves, Move{From: path, To: target})
+
+		// Subtitles keep whatever follows the video name, such as ".en.srt"
+		videoStem := strings.TrimSuffix(path, filepath.Ext(path))
+		targetStem := strings.TrimSuffix(target, filepath.Ext(target))
+		for _, sub := range subtitlesFor(path, paths) {
+			suffix := strings.TrimPrefix(sub, videoStem)
+			if suffix == sub {
+				suffix = "." + filepath.Base(sub)
+			}
+			subTarget := targetStem + suffix
+			if claimed[subTarget] || fileExists(subTarget) {
+				moves = append(moves, Move{From: sub, Note: "target already exists"})
+				continue
+			}
+			claimed[subTarget] = true
+			moves = append(moves, Move{From: sub, To: subTarget})
+		}
+	}
+
+	return moves, nil
+}
+
+// Apply carries out a plan and points the download's file paths at the new
+// locations. Files moved before an error are still recorded. The caller
+// saves the download.
+func (s *OrganizerService) Apply(library *sandbox.Root, download *models.Download, moves []Move) error {
+	var err error
+	moved := make(map[string]string)
+	for _, move := range moves {
+		if move.To == "" {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(move.To), 0755); err != nil {
+			err = fmt.Errorf("failed to create folder: %w", err)
+			break
+		}
+		if err = os.Rename(move.From, move.To); err != nil {
+			err = fmt.Errorf("failed to move %s: %w", filepath.Base(move.From), err)
+			break
+		}
+		log.Printf("Organized %s -> %s", move.From, move.To)
+		moved[move.From] = move.To
+	}
+
+	var paths []string
+	for _, path := range downloadPaths(download) {
+		if to, ok := moved[path]; ok {
+			path = to
+		}
+		paths = append(paths, path)
+	}
+	pathsJSON, _ := json.Marshal(paths)
+	download.FilePaths = string(pathsJSON)
+
+	var results []models.FileResult
+	if download.FileResults != "" && json.Unmarshal([]byte(download.FileResults), &results) == nil {
+		for i := range results {
+			if to, ok := moved[results[i].Path]; ok {
+				results[i].Path = to
+			}
+		}
+		resultsJSON, _ := json.Marshal(results)
+		download.FileResults = string(resultsJSON)
+	}
+
+	// Leave no empty release folders behind
+	for from := range moved {
+		removeEmptyParents(filepath.Dir(from), library.Path())
+	}
+
+	return err
+}
+
+// target renders the naming template for a release
+func (s *OrganizerService) target(library *sandbox.Root, info models.ReleaseInfo, ext string) (string, error) {
+	data := NameData{
+		Title:        info.Title,
+		Year:         info.Year,
+		EpisodeLabel: info.EpisodeLabel(),
+		Resolution:   info.Resolution,
+		Source:       info.Source,
+		VideoCodec:   info.VideoCodec,
+		AudioCodec:   info.AudioCodec,
+		HDR:          strings.Join(info.HDR, " "),
+		Group:        info.Group,
+		Proper:       info.Proper,
+		Repack:       info.Repack,
+	}
+
+	tmpl := s.movieTemplate
+	if info.IsSeries() {
+		tmpl = s.episodeTemplate
+		if len(info.Seasons) > 0 {
+			data.Season = info.Seasons[0]
+		}
+		data.Episode = info.Episodes[0]
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render name: %w", err)
+	}
+
+	// Sanitizing drops empty path elements, so guard against a blank name
+	name := strings.TrimSpace(buf.String())
+	if sandbox.SanitizeName(filepath.Base(name)) == "" {
+		return "", fmt.Errorf("naming template produced an empty name for %q", info.Title)
+	}
+	return library.Join(name + ext)
+}
+
+// downloadPaths returns the files recorded for a download
+func downloadPaths(download *models.Download) []string {
+	var paths []string
+	if download.FilePaths != "" {
+		json.Unmarshal([]byte(download.FilePaths), &paths)
+	}
+	return paths
+}
+
+// subtitlesFor finds the subtitles that belong to a video: files next to
+// it that start with its name, such as Movie.en.srt, and subtitles from
+// the same download when it is the only video in its folder
+func subtitlesFor(video string, paths []string) []string {
+	dir := filepath.Dir(video)
+	stem := strings.TrimSuffix(filepath.Base(video), filepath.Ext(video))
+
+	seen := make(map[string]bool)
+	var subs []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			subs = append(subs, path)
+		}
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if !e.IsDir() && isSubtitle(e.Name()) && strings.HasPrefix(e.Name(), stem) {
+				add(filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+
+	videos := 0
+	for _, p := range paths {
+		if isVideo(p) && filepath.Dir(p) == dir {
+			videos++
+		}
+	}
+	if videos == 1 {
+		for _, p := range paths {
+			// Releases often keep subtitles in a Subs folder next to the video
+			if isSubtitle(p) && (filepath.Dir(p) == dir || filepath.Dir(filepath.Dir(p)) == dir) {
+				add(p)
+			}
+		}
+	}
+
+	return subs
+}
+
+// removeEmptyParents removes dir and its parents while they are empty,
+// stopping at root
+func removeEmptyParents(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SubliminalProvider fetches subtitles by running the Python subliminal
+// command line tool
+type SubliminalProvider struct {
+	path string // "" when subliminal isn't installed
+}
+
+// NewSubliminalProvider finds subliminal at customPath, or in PATH when it
+// is "". The provider is unavailable if it can't be found.
+func NewSubliminalProvider(customPath string) *SubliminalProvider {
+	// If custom path is provided, use it
+	if customPath != "" {
+		// Verify the custom path exists and is executable
+		if _, err := exec.LookPath(customPath); err != nil {
+			log.Printf("Warning: subliminal not found at custom path %s: %v", customPath, err)
+			return &SubliminalProvider{}
+		}
+		log.Printf("Using subliminal at: %s", customPath)
+		return &SubliminalProvider{path: customPath}
+	}
+
+	// Check if subliminal is available in PATH
+	path, err := exec.LookPath("subliminal")
+	if err != nil {
+		log.Println("subliminal not found in PATH. To use it for subtitles, install it with pip install subliminal")
+		log.Println("or specify the path with --subliminal-path")
+		return &SubliminalProvider{}
+	}
+
+	log.Printf("Using subliminal at: %s", path)
+	return &SubliminalProvider{path: path}
+}
+
+func (p *SubliminalProvider) Name() string {
+	return "subliminal"
+}
+
+func (p *SubliminalProvider) Available() bool {
+	return p.path != ""
+}
+
+// Fetch runs subliminal, which saves subtitles as Movie.en.srt
+func (p *SubliminalProvider) Fetch(ctx context.Context, videoPath, language string) (string, error) {
+	if !p.Available() {
+		return "", fmt.Errorf("subliminal not installed")
+	}
+
+	cmd := exec.CommandContext(ctx, p.path, "download", "-l", language, videoPath)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("subliminal timed out")
+	}
+	if err != nil {
+		return "", fmt.Errorf("subliminal failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// subliminal succeeds without downloading anything when it finds nothing
+	path := subtitlePath(videoPath, language)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNoSubtitles
+	}
+	return path, nil
+}
@@ -2,75 +2,142 @@ package services
 
 import (
 	"context"
+	"errors"
 	"log"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// ErrNoSubtitles is returned by a SubtitleProvider that found nothing
+var ErrNoSubtitles = errors.New("no subtitles found")
+
+// providerTimeout bounds how long one provider may search and download
+const providerTimeout = 2 * time.Minute
+
+// SubtitleProvider finds subtitles for a video and saves them next to it
+type SubtitleProvider interface {
+	Name() string
+	Available() bool
+	// Fetch saves subtitles in a language, given as an ISO 639-1 code, and
+	// returns their path
+	Fetch(ctx context.Context, videoPath, language string) (string, error)
+}
+
+// SubtitleService chains subtitle providers, asking each in turn until one
+// finds subtitles. It is a provider itself, so chains can be nested.
 type SubtitleService struct {
-	available      bool
-	subliminalPath string
+	providers []SubtitleProvider
 }
 
-func NewSubtitleService(customPath string) *SubtitleService {
-	var subliminalPath string
-
-	// If custom path is provided, use it
-	if customPath != "" {
-		subliminalPath = customPath
-		// Verify the custom path exists and is executable
-		if _, err := exec.LookPath(customPath); err != nil {
-			log.Printf("Warning: subliminal not found at custom path %s: %v", customPath, err)
-			log.Println("Subtitle downloads will be skipped.")
-			return &SubtitleService{available: false, subliminalPath: ""}
+// NewSubtitleService chains the available providers, in order
+func NewSubtitleService(providers ...SubtitleProvider) *SubtitleService {
+	s := &SubtitleService{}
+	for _, p := range providers {
+		if p != nil && p.Available() {
+			s.providers = append(s.providers, p)
 		}
-		log.Printf("Using subliminal at: %s", subliminalPath)
-		return &SubtitleService{available: true, subliminalPath: subliminalPath}
 	}
 
-	// Check if subliminal is available in PATH
-	path, err := exec.LookPath("subliminal")
-	if err != nil {
-		log.Println("Warning: subliminal not found in PATH. Subtitle downloads will be skipped.")
-		log.Println("To enable subtitles, install subliminal: pip install subliminal")
-		log.Println("Or specify the path with --subliminal-path flag")
-		return &SubtitleService{available: false, subliminalPath: ""}
+	if len(s.providers) == 0 {
+		log.Println("Warning: no subtitle provider available. Subtitle downloads will be skipped.")
+	} else {
+		log.Printf("Subtitle providers: %s", s.Name())
+	}
+	return s
+}
+
+func (s *SubtitleService) Name() string {
+	names := make([]string, len(s.providers))
+	for i, p := range s.providers {
+		names[i] = p.Name()
 	}
+	return strings.Join(names, ", ")
+}
 
-	log.Printf("Using subliminal at: %s", path)
-	return &SubtitleService{available: true, subliminalPath: path}
+func (s *SubtitleService) Available() bool {
+	return len(s.providers) > 0
 }
 
 func (s *SubtitleService) IsAvailable() bool {
-	return s.available
+	return s.Available()
 }
 
-func (s *SubtitleService) DownloadSubtitles(videoPath string) error {
-	if !s.available {
-		log.Printf("Skipping subtitle download for %s (subliminal not available)", videoPath)
-		return nil
+// Fetch returns subtitles already next to the video, or asks the providers
+// in turn. Each gets providerTimeout. When none finds anything, the first
+// real failure is returned, or ErrNoSubtitles.
+func (s *SubtitleService) Fetch(ctx context.Context, videoPath, language string) (string, error) {
+	path := subtitlePath(videoPath, language)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
 	}
 
-	log.Printf("Downloading subtitles for: %s", videoPath)
+	var failure error
+	for _, p := range s.providers {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		pctx, cancel := context.WithTimeout(ctx, providerTimeout)
+		path, err := p.Fetch(pctx, videoPath, language)
+		cancel()
+		if err == nil {
+			log.Printf("Downloaded %s subtitles for %s from %s", language, filepath.Base(videoPath), p.Name())
+			return path, nil
+		}
+		if errors.Is(err, ErrNoSubtitles) {
+			log.Printf("No %s subtitles for %s on %s", language, filepath.Base(videoPath), p.Name())
+			continue
+		}
+		log.Printf("Subtitle provider %s failed for %s: %v", p.Name(), filepath.Base(videoPath), err)
+		if failure == nil {
+			failure = err
+		}
+	}
 
-	// Create a context with timeout (2 minutes should be enough for subtitle search)
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
+	if failure != nil {
+		return "", failure
+	}
+	return "", ErrNoSubtitles
+}
 
-	// Run subliminal to download English subtitles
-	cmd := exec.CommandContext(ctx, s.subliminalPath, "download", "-l", "en", videoPath)
-	output, err := cmd.CombinedOutput()
+// LanguageResult is the outcome of fetching subtitles in one language
+type LanguageResult struct {
+	Language string
+	Path     string // Where the subtitles were saved
+	Err      error
+}
 
-	if ctx.Err() == context.DeadlineExceeded {
-		log.Printf("Subliminal timeout for %s", videoPath)
-		return ctx.Err()
+// Status describes the result as ok, none found or failed
+func (r LanguageResult) Status() string {
+	switch {
+	case r.Err == nil:
+		return "ok"
+	case errors.Is(r.Err, ErrNoSubtitles):
+		return "none found"
+	default:
+		return "failed"
 	}
+}
 
-	if err != nil {
-		log.Printf("Subliminal error: %v\nOutput: %s", err, string(output))
-		return err
+// DownloadSubtitles fetches subtitles for a video in each language, saved
+// as Movie.en.srt, Movie.es.srt and so on. Once ctx is done the languages
+// not yet tried are left out of the results.
+func (s *SubtitleService) DownloadSubtitles(ctx context.Context, videoPath string, languages []string) []LanguageResult {
+	results := make([]LanguageResult, 0, len(languages))
+	for _, language := range languages {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("Downloading %s subtitles for: %s", language, videoPath)
+		path, err := s.Fetch(ctx, videoPath, language)
+		results = append(results, LanguageResult{Language: language, Path: path, Err: err})
 	}
+	return results
+}
 
-	log.Printf("Subliminal output: %s", string(output))
-	return nil
+// subtitlePath names subtitles after their video and language, such as
+// Movie.en.srt
+func subtitlePath(videoPath, language string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "." + language + ".srt"
 }
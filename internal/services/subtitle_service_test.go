@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/opensubtitles"
+)
+
+// subtitleStandIn plays the OpenSubtitles API. Hash and title searches get
+// their own canned results, or fail with a status.
+type subtitleStandIn struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	hashResults  string // JSON data array for moviehash searches
+	hashStatus   int
+	titleResults string
+	titleStatus  int
+	queries      []string
+}
+
+func newSubtitleStandIn(t *testing.T) *subtitleStandIn {
+	s := &subtitleStandIn{hashResults: "[]", titleResults: "[]"}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/subtitles":
+			s.queries = append(s.queries, r.URL.RawQuery)
+			results, status := s.titleResults, s.titleStatus
+			if r.URL.Query().Get("moviehash") != "" {
+				results, status = s.hashResults, s.hashStatus
+			}
+			if status != 0 {
+				http.Error(w, `{"message":"unavailable"}`, status)
+				return
+			}
+			fmt.Fprintf(w, `{"data":%s}`, results)
+		case r.URL.Path == "/download":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			fmt.Fprintf(w, `{"link":"%s/files/%v"}`, s.URL, body["file_id"])
+		case strings.HasPrefix(r.URL.Path, "/files/"):
+			fmt.Fprintf(w, "file %s\n", strings.TrimPrefix(r.URL.Path, "/files/"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func result(fileID, downloads int, hashMatch bool) string {
+	return fmt.Sprintf(`{"attributes":{"download_count":%d,"moviehash_match":%v,"files":[{"file_id":%d}]}}`, downloads, hashMatch, fileID)
+}
+
+// testVideo creates an empty video named like a release
+func testVideo(t *testing.T, name string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOpenSubtitlesProvider(t *testing.T) {
+	tests := []struct {
+		name         string
+		hashResults  string
+		hashStatus   int
+		titleResults string
+		wantFile     string // Contents of the saved subtitles, "" for none
+		wantSearches int
+	}{
+		{
+			name:         "hash match",
+			hashResults:  "[" + result(1, 5, true) + "]",
+			titleResults: "[" + result(2, 500, false) + "]",
+			wantFile:     "file 1\n",
+			wantSearches: 1,
+		},
+		{
+			name:         "hash without exact match",
+			hashResults:  "[" + result(1, 5, false) + "]",
+			titleResults: "[" + result(2, 5, false) + "," + result(3, 50, false) + "]",
+			wantFile:     "file 3\n",
+			wantSearches: 2,
+		},
+		{
+			name:         "hash search rate limited",
+			hashStatus:   http.StatusTooManyRequests,
+			titleResults: "[" + result(2, 5, false) + "]",
+			wantFile:     "file 2\n",
+			wantSearches: 2,
+		},
+		{
+			name:         "hash search server error",
+			hashStatus:   http.StatusBadGateway,
+			titleResults: "[" + result(2, 5, false) + "]",
+			wantFile:     "file 2\n",
+			wantSearches: 2,
+		},
+		{
+			name:         "nothing found",
+			wantSearches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSubtitleStandIn(t)
+			server.hashResults = or(tt.hashResults, "[]")
+			server.hashStatus = tt.hashStatus
+			server.titleResults = or(tt.titleResults, "[]")
+			provider := NewOpenSubtitlesProvider(opensubtitles.NewClient(server.URL, "key", "", ""))
+
+			video := testVideo(t, "The.Movie.2019.1080p.BluRay.x264-GRP.mkv")
+			path, err := provider.Fetch(context.Background(), video, "es")
+			if tt.wantFile == "" {
+				if !errors.Is(err, ErrNoSubtitles) {
+					t.Fatalf("Fetch = %q, %v, want ErrNoSubtitles", path, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Fetch: %v", err)
+				}
+				if want := strings.TrimSuffix(video, ".mkv") + ".es.srt"; path != want {
+					t.Errorf("saved to %s, want %s", path, want)
+				}
+				if got := readFile(t, path); got != tt.wantFile {
+					t.Errorf("saved %q, want %q", got, tt.wantFile)
+				}
+			}
+
+			if len(server.queries) != tt.wantSearches {
+				t.Fatalf("searches = %v, want %d", server.queries, tt.wantSearches)
+			}
+			if tt.wantSearches == 2 {
+				if want := "languages=es&query=the+movie&year=2019"; server.queries[1] != want {
+					t.Errorf("title search = %q, want %q", server.queries[1], want)
+				}
+			}
+		})
+	}
+}
+
+func or(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func TestTitleSearch(t *testing.T) {
+	tests := []struct {
+		path string
+		want opensubtitles.SearchParams
+	}{
+		{"/lib/The.Movie.2019.1080p.mkv", opensubtitles.SearchParams{Query: "The Movie", Year: 2019}},
+		{"/lib/Show.S02E05.720p.WEB.mkv", opensubtitles.SearchParams{Query: "Show", Season: 2, Episode: 5}},
+		{"/lib/Some Film (2001)/1080p.mkv", opensubtitles.SearchParams{Query: "Some Film", Year: 2001}},
+	}
+	for _, tt := range tests {
+		got := titleSearch(tt.path)
+		if got.Query != tt.want.Query || got.Year != tt.want.Year || got.Season != tt.want.Season || got.Episode != tt.want.Episode {
+			t.Errorf("titleSearch(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// fakeSubliminal writes a script that behaves like subliminal: it saves
+// Movie.<lang>.srt next to the video, unless the language is "none"
+func fakeSubliminal(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "subliminal")
+	script := `#!/bin/sh
+# subliminal download -l LANG VIDEO
+[ "$3" = none ] && exit 0
+echo "from subliminal" > "${4%.*}.$3.srt"
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSubtitleChainFallsBackToSubliminal(t *testing.T) {
+	server := newSubtitleStandIn(t)
+	server.hashStatus = http.StatusServiceUnavailable
+	server.titleStatus = http.StatusServiceUnavailable
+	chain := NewSubtitleService(
+		NewOpenSubtitlesProvider(opensubtitles.NewClient(server.URL, "key", "", "")),
+		NewSubliminalProvider(fakeSubliminal(t)),
+	)
+
+	video := testVideo(t, "The.Movie.2019.1080p.mkv")
+	path, err := chain.Fetch(context.Background(), video, "en")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if got := readFile(t, path); got != "from subliminal\n" {
+		t.Errorf("saved %q", got)
+	}
+
+	// Subtitles already there are kept without asking anyone
+	server.queries = nil
+	if again, err := chain.Fetch(context.Background(), video, "en"); err != nil || again != path {
+		t.Errorf("second Fetch = %q, %v", again, err)
+	}
+	if len(server.queries) != 0 {
+		t.Errorf("searched again: %v", server.queries)
+	}
+}
+
+// stubProvider returns a fixed error, or saves subtitles when it is nil
+type stubProvider struct {
+	name  string
+	err   error
+	calls *[]string
+}
+
+func (p stubProvider) Name() string    { return p.name }
+func (p stubProvider) Available() bool { return true }
+
+func (p stubProvider) Fetch(ctx context.Context, videoPath, language string) (string, error) {
+	*p.calls = append(*p.calls, p.name)
+	if p.err != nil {
+		return "", p.err
+	}
+	path := subtitlePath(videoPath, language)
+	return path, os.WriteFile(path, []byte(p.name), 0644)
+}
+
+func TestSubtitleChain(t *testing.T) {
+	failure := errors.New("provider down")
+	tests := []struct {
+		name      string
+		errs      []error // One provider per error
+		wantErr   error
+		wantCalls string
+	}{
+		{"first finds", []error{nil, nil}, nil, "p0"},
+		{"fall through not found", []error{ErrNoSubtitles, nil}, nil, "p0 p1"},
+		{"fall through failure", []error{failure, nil}, nil, "p0 p1"},
+		{"none found", []error{ErrNoSubtitles, ErrNoSubtitles}, ErrNoSubtitles, "p0 p1"},
+		{"failure reported over none found", []error{ErrNoSubtitles, failure}, failure, "p0 p1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			var providers []SubtitleProvider
+			for i, err := range tt.errs {
+				providers = append(providers, stubProvider{name: fmt.Sprintf("p%d", i), err: err, calls: &calls})
+			}
+			chain := NewSubtitleService(providers...)
+
+			_, err := chain.Fetch(context.Background(), testVideo(t, "Movie.mkv"), "en")
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Fetch error = %v, want %v", err, tt.wantErr)
+			}
+			if got := strings.Join(calls, " "); got != tt.wantCalls {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDownloadSubtitlesPerLanguage(t *testing.T) {
+	var calls []string
+	chain := NewSubtitleService(
+		NewSubliminalProvider(fakeSubliminal(t)),
+		stubProvider{name: "stub", err: ErrNoSubtitles, calls: &calls},
+	)
+
+	video := testVideo(t, "Movie.mkv")
+	results := chain.DownloadSubtitles(context.Background(), video, []string{"es", "none", "my"})
+
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Language+" "+r.Status()+" "+filepath.Base(r.Path))
+	}
+	want := []string{"es ok Movie.es.srt", "none none found .", "my ok Movie.my.srt"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+}
+
+func TestBestSubtitle(t *testing.T) {
+	results := []models.SubtitleResult{
+		{Attributes: models.SubtitleAttributes{DownloadCount: 900}},
+		{Attributes: models.SubtitleAttributes{DownloadCount: 500, MachineMade: true, Files: []models.SubtitleFile{{FileID: 1}}}},
+		{Attributes: models.SubtitleAttributes{DownloadCount: 20, Files: []models.SubtitleFile{{FileID: 2}}}},
+		{Attributes: models.SubtitleAttributes{DownloadCount: 10, Files: []models.SubtitleFile{{FileID: 3}}}},
+	}
+	if got := bestSubtitle(results); got == nil || got.FileID != 2 {
+		t.Errorf("best = %+v, want file 2", got)
+	}
+
+	results[3].Attributes.MovieHashMatch = true
+	if got := bestSubtitle(results); got == nil || got.FileID != 3 {
+		t.Errorf("best = %+v, want the hash match, file 3", got)
+	}
+
+	if got := bestSubtitle(results[:1]); got != nil {
+		t.Errorf("best of results without files = %+v", got)
+	}
+}
+
+// cancellingProvider stops the job the first time it is asked
+type cancellingProvider struct {
+	cancel context.CancelFunc
+	calls  *[]string
+}
+
+func (p cancellingProvider) Name() string    { return "cancelling" }
+func (p cancellingProvider) Available() bool { return true }
+
+func (p cancellingProvider) Fetch(ctx context.Context, videoPath, language string) (string, error) {
+	*p.calls = append(*p.calls, language)
+	p.cancel()
+	return "", ctx.Err()
+}
+
+func TestDownloadSubtitlesStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls, later []string
+	chain := NewSubtitleService(
+		cancellingProvider{cancel: cancel, calls: &calls},
+		stubProvider{name: "later", calls: &later},
+	)
+
+	results := chain.DownloadSubtitles(ctx, testVideo(t, "Movie.mkv"), []string{"en", "es", "my"})
+	if len(results) != 1 || !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("results = %+v, want only the cancelled en", results)
+	}
+	if strings.Join(calls, " ") != "en" || len(later) != 0 {
+		t.Errorf("asked %v then %v after cancelling", calls, later)
+	}
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// ErrTrashItemNotFound is returned for trash IDs that don't exist
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+// trashIDPattern matches the IDs made by newTrashID, so an ID from a
+// request can't name anything else on disk
+var trashIDPattern = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{8}$`)
+
+// trashPurgeInterval is how often expired items are looked for
+const trashPurgeInterval = time.Hour
+
+// TrashService moves deleted files into a .trash folder inside their
+// library instead of removing them. Each item is kept in its own folder
+// next to a JSON file recording where it came from and when it was
+// deleted, so the trash survives restarts without the database.
+type TrashService struct {
+	libraries *Libraries
+	catalog   *CatalogService
+	retention time.Duration // How long items are kept, 0 until purged by hand
+
+	mu     sync.Mutex // Serialises changes to the trash folders
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewTrashService(libraries *Libraries, catalog *CatalogService, retention time.Duration) *TrashService {
+	return &TrashService{
+		libraries: libraries,
+		catalog:   catalog,
+		retention: retention,
+	}
+}
+
+// Start purges expired items in the background, now and then every hour
+func (s *TrashService) Start() {
+	if s.retention <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.purgeExpired()
+
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.purgeExpired()
+			}
+		}
+	}()
+}
+
+func (s *TrashService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// Retention returns how long items are kept, 0 if they never expire
+func (s *TrashService) Retention() time.Duration {
+	return s.retention
+}
+
+// Trash moves a file or folder of a library into its trash. An empty
+// library means the default one.
+func (s *TrashService) Trash(library, relativePath string) (*models.TrashItem, error) {
+	library, trashPath, err := s.trashPath(library)
+	if err != nil {
+		return nil, err
+	}
+	root, _ := s.libraries.Root(library)
+	fullPath, err := root.Resolve(relativePath)
+	if err != nil || fullPath == root.Path() {
+		return nil, fmt.Errorf("invalid path")
+	}
+	rel, _ := filepath.Rel(root.Path(), fullPath)
+	if topLevel(rel) == models.TrashDir {
+		return nil, fmt.Errorf("invalid path")
+	}
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	item := &models.TrashItem{
+		Library:      library,
+		Name:         filepath.Base(fullPath),
+		OriginalPath: filepath.ToSlash(rel),
+		DeletedAt:    time.Now(),
+		Size:         info.Size(),
+		IsFolder:     info.IsDir(),
+	}
+	if item.IsFolder {
+		item.Size = folderSize(fullPath)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(trashPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create trash folder: %w", err)
+	}
+	if item.ID, err = newTrashID(trashPath, item.DeletedAt); err != nil {
+		return nil, err
+	}
+	itemDir := filepath.Join(trashPath, item.ID)
+
+	// The metadata goes first, so an item is never in the trash without it
+	if err := writeTrashInfo(trashPath, item); err != nil {
+		os.Remove(itemDir)
+		return nil, err
+	}
+	if err := os.Rename(fullPath, filepath.Join(itemDir, item.Name)); err != nil {
+		os.Remove(trashInfoPath(trashPath, item.ID))
+		os.Remove(itemDir)
+		return nil, fmt.Errorf("failed to move %s to the trash: %w", item.Name, err)
+	}
+
+	log.Printf("Moved %s to the trash of library %s", item.OriginalPath, library)
+	s.catalog.Refresh(library, fullPath)
+	return item, nil
+}
+
+// List returns the trash of one library, or of every library when library
+// is empty, most recently deleted first
+func (s *TrashService) List(library string) ([]models.TrashItem, error) {
+	names, err := s.libraryNames(library)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.TrashItem
+	for _, name := range names {
+		_, trashPath, _ := s.trashPath(name)
+		found, err := readTrash(name, trashPath)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, found...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Restore moves an item back to where it was deleted from. It fails if
+// something else has taken that path since.
+func (s *TrashService) Restore(library, id string) (*models.TrashItem, error) {
+	library, trashPath, err := s.trashPath(library)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := readTrashInfo(library, trashPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	root, _ := s.libraries.Root(library)
+	dest, err := root.Resolve(item.OriginalPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return nil, fmt.Errorf("%s already exists", item.OriginalPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	if err := os.Rename(filepath.Join(trashPath, id, item.Name), dest); err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", item.Name, err)
+	}
+	if err := removeTrashItem(trashPath, id); err != nil {
+		log.Printf("Failed to clean up trash item %s: %v", id, err)
+	}
+
+	log.Printf("Restored %s from the trash of library %s", item.OriginalPath, library)
+	s.catalog.Refresh(library, dest)
+	return item, nil
+}
+
+// Purge deletes an item from the trash for good
+func (s *TrashService) Purge(library, id string) error {
+	library, trashPath, err := s.trashPath(library)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := readTrashInfo(library, trashPath, id); err != nil {
+		return err
+	}
+	return removeTrashItem(trashPath, id)
+}
+
+// Empty deletes everything in the trash of one library, or of every
+// library when library is empty. It returns how many items were purged.
+func (s *TrashService) Empty(library string) (int, error) {
+	return s.purge(library, func(models.TrashItem) bool { return true })
+}
+
+// purgeExpired deletes the items that have been in the trash longer than
+// the retention period
+func (s *TrashService) purgeExpired() {
+	cutoff := time.Now().Add(-s.retention)
+	n, err := s.purge("", func(item models.TrashItem) bool {
+		return item.DeletedAt.Before(cutoff)
+	})
+	if err != nil {
+		log.Printf("Failed to purge expired trash: %v", err)
+	}
+	if n > 0 {
+		log.Printf("Purged %d expired items from the trash", n)
+	}
+}
+
+func (s *TrashService) purge(library string, match func(models.TrashItem) bool) (int, error) {
+	items, err := s.List(library)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for _, item := range items {
+		if !match(item) {
+			continue
+		}
+		_, trashPath, _ := s.trashPath(item.Library)
+		if err := removeTrashItem(trashPath, item.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// trashPath returns the trash folder of a library, resolving "" to the
+// default library
+func (s *TrashService) trashPath(library string) (string, string, error) {
+	root, err := s.libraries.Root(library)
+	if err != nil {
+		return "", "", err
+	}
+	if library == "" {
+		library = s.libraries.Default()
+	}
+	return library, filepath.Join(root.Path(), models.TrashDir), nil
+}
+
+func (s *TrashService) libraryNames(library string) ([]string, error) {
+	if library != "" {
+		if _, err := s.libraries.Root(library); err != nil {
+			return nil, err
+		}
+		return []string{library}, nil
+	}
+	var names []string
+	for _, lib := range s.libraries.List() {
+		names = append(names, lib.Name)
+	}
+	return names, nil
+}
+
+// newTrashID creates the folder of a new trash item and returns its ID,
+// made of the deletion time and a random suffix
+func newTrashID(trashPath string, deletedAt time.Time) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		id := deletedAt.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+		err := os.Mkdir(filepath.Join(trashPath, id), 0755)
+		if err == nil {
+			return id, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create trash folder: %w", err)
+		}
+	}
+	return "", fmt.Errorf("failed to pick a trash ID")
+}
+
+func trashInfoPath(trashPath, id string) string {
+	return filepath.Join(trashPath, id+".json")
+}
+
+func writeTrashInfo(trashPath string, item *models.TrashItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(trashInfoPath(trashPath, item.ID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write trash info: %w", err)
+	}
+	return nil
+}
+
+// readTrashInfo loads the metadata of a trash item. The library is taken
+// from where the trash is, not from the file.
+func readTrashInfo(library, trashPath, id string) (*models.TrashItem, error) {
+	if !trashIDPattern.MatchString(id) {
+		return nil, ErrTrashItemNotFound
+	}
+	data, err := os.ReadFile(trashInfoPath(trashPath, id))
+	if os.IsNotExist(err) {
+		return nil, ErrTrashItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("invalid trash info for %s: %w", id, err)
+	}
+	item.ID = id
+	item.Library = library
+	if item.Name == "" || item.Name != filepath.Base(item.Name) {
+		return nil, fmt.Errorf("invalid trash info for %s", id)
+	}
+	return &item, nil
+}
+
+// readTrash lists the items in a trash folder, skipping any whose
+// metadata can't be read
+func readTrash(library, trashPath string) ([]models.TrashItem, error) {
+	entries, err := os.ReadDir(trashPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.TrashItem
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		item, err := readTrashInfo(library, trashPath, id)
+		if err != nil {
+			if !errors.Is(err, ErrTrashItemNotFound) {
+				log.Printf("Skipping trash item: %v", err)
+			}
+			continue
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// removeTrashItem deletes an item and its metadata
+func removeTrashItem(trashPath, id string) error {
+	if err := os.RemoveAll(filepath.Join(trashPath, id)); err != nil {
+		return err
+	}
+	if err := os.Remove(trashInfoPath(trashPath, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// folderSize adds up the sizes of the files under path
+func folderSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
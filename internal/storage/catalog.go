@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// catalogBatchSize bounds how many rows are written per statement, to
+// stay under SQLite's variable limit
+const catalogBatchSize = 200
+
+// GetLibraryFiles returns the cataloged files of a library, or only those
+// of one top level entry when entry is not ""
+func (r *Repository) GetLibraryFiles(library, entry string) ([]models.LibraryFile, error) {
+	var files []models.LibraryFile
+	query := r.db.Where("library = ?", library)
+	if entry != "" {
+		query = query.Where("entry = ?", entry)
+	}
+	if err := query.Find(&files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// CatalogChanges is the outcome of a scan, applied in one transaction
+type CatalogChanges struct {
+	Library       string
+	SaveFiles     []models.LibraryFile // New or changed files
+	DeleteFiles   []string             // Paths of files that are gone
+	SaveEntries   []models.LibraryEntry
+	DeleteEntries []string // Paths of entries that no longer hold media
+}
+
+// ApplyCatalogChanges writes the result of a scan
+func (r *Repository) ApplyCatalogChanges(changes CatalogChanges) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(changes.DeleteFiles); start += catalogBatchSize {
+			batch := changes.DeleteFiles[start:min(start+catalogBatchSize, len(changes.DeleteFiles))]
+			if err := tx.Where("library = ? AND path IN ?", changes.Library, batch).Delete(&models.LibraryFile{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(changes.SaveFiles) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "library"}, {Name: "path"}},
+				DoUpdates: clause.AssignmentColumns([]string{"entry", "size", "mod_time", "file_type", "media", "probed"}),
+			}).CreateInBatches(changes.SaveFiles, catalogBatchSize).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for start := 0; start < len(changes.DeleteEntries); start += catalogBatchSize {
+			batch := changes.DeleteEntries[start:min(start+catalogBatchSize, len(changes.DeleteEntries))]
+			if err := tx.Where("library = ? AND path IN ?", changes.Library, batch).Delete(&models.LibraryEntry{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(changes.SaveEntries) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "library"}, {Name: "path"}},
+				DoUpdates: clause.AssignmentColumns([]string{"name", "is_folder", "size", "mod_time", "file_type", "stem", "videos", "subtitles", "media"}),
+			}).CreateInBatches(changes.SaveEntries, catalogBatchSize).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EntryCursor is the last entry of a page, which the next page starts after
+type EntryCursor struct {
+	Library string    `json:"l"`
+	ID      uint      `json:"i,omitempty"` // 0 to start at the top of Library
+	Name    string    `json:"n,omitempty"`
+	Size    int64     `json:"s,omitempty"`
+	ModTime time.Time `json:"t,omitempty"`
+}
+
+// sortColumns maps sort orders to the column they compare
+var sortColumns = map[string]string{
+	models.SortDate: "mod_time",
+	models.SortName: "name COLLATE NOCASE",
+	models.SortSize: "size",
+}
+
+// QueryLibraryEntries returns up to limit entries of a library matching
+// the query, starting after the cursor. A limit of 0 returns them all.
+func (r *Repository) QueryLibraryEntries(library string, q models.MovieQuery, after *EntryCursor, limit int) ([]models.LibraryEntry, error) {
+	query := r.db.Model(&models.LibraryEntry{}).Where("library = ?", library)
+
+	if q.Search != "" {
+		query = query.Where(`name LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(q.Search)+"%")
+	}
+	switch q.FileType {
+	case "video":
+		query = query.Where("videos > 0")
+	case "subtitle":
+		query = query.Where("subtitles > 0")
+	}
+	if q.Folders != nil {
+		query = query.Where("is_folder = ?", *q.Folders)
+	}
+	if q.MinSize > 0 {
+		query = query.Where("size >= ?", q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		query = query.Where("size <= ?", q.MaxSize)
+	}
+	if q.After != nil {
+		query = query.Where("mod_time >= ?", *q.After)
+	}
+	if q.Before != nil {
+		query = query.Where("mod_time < ?", *q.Before)
+	}
+	if q.MissingSubtitles {
+		// Loose videos count subtitles next to them, such as Movie.en.srt
+		query = query.Where(`videos > 0 AND subtitles = 0 AND (is_folder OR NOT EXISTS (
+			SELECT 1 FROM library_entries s
+			WHERE s.library = library_entries.library AND s.file_type = 'subtitle'
+				AND substr(s.name, 1, length(library_entries.stem) + 1) = library_entries.stem || '.'))`)
+	}
+
+	column := sortColumns[q.Sort]
+	if column == "" {
+		column = sortColumns[models.SortDate]
+	}
+	cmp, dir := ">", "ASC"
+	if q.Desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	if after != nil && after.ID != 0 {
+		var value interface{}
+		switch q.Sort {
+		case models.SortName:
+			value = after.Name
+		case models.SortSize:
+			value = after.Size
+		default:
+			value = after.ModTime
+		}
+		query = query.Where(
+			fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", column, cmp),
+			value, value, after.ID,
+		)
+	}
+
+	query = query.Order(column + " " + dir).Order("id " + dir)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var entries []models.LibraryEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// DeleteLibrariesExcept drops the catalog of libraries that are no longer
+// configured
+func (r *Repository) DeleteLibrariesExcept(libraries []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("library NOT IN ?", libraries).Delete(&models.LibraryFile{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("library NOT IN ?", libraries).Delete(&models.LibraryEntry{}).Error
+	})
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EnqueueJob adds a job for a download unless one is already queued
+func (r *Repository) EnqueueJob(downloadID uint) error {
+	job := &models.Job{DownloadID: downloadID, CreatedAt: time.Now().UTC()}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "download_id"}},
+		DoNothing: true,
+	}).Create(job).Error
+}
+
+// ClaimJob leases the next available job to owner. It returns nil when
+// there is nothing to do.
+func (r *Repository) ClaimJob(owner string, lease time.Duration) (*models.Job, error) {
+	var claimed *models.Job
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+
+		var job models.Job
+		err := waitingJobs(tx, now).Take(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		expires := now.Add(lease)
+		result := tx.Model(&models.Job{}).
+			Where("id = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", job.ID, now).
+			Updates(map[string]interface{}{
+				"lease_owner":      owner,
+				"lease_expires_at": expires,
+				"heartbeat_at":     now,
+				"attempts":         gorm.Expr("attempts + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Someone else got there first
+			return nil
+		}
+
+		job.LeaseOwner = owner
+		job.LeaseExpiresAt = &expires
+		job.HeartbeatAt = &now
+		job.Attempts++
+		claimed = &job
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// HeartbeatJob extends the lease owner holds on a job
+func (r *Repository) HeartbeatJob(id uint, owner string, lease time.Duration) error {
+	now := time.Now().UTC()
+	return r.db.Model(&models.Job{}).Where("id = ? AND lease_owner = ?", id, owner).Updates(map[string]interface{}{
+		"lease_expires_at": now.Add(lease),
+		"heartbeat_at":     now,
+	}).Error
+}
+
+// ReleaseJob gives up the lease on a job so another worker can claim it
+func (r *Repository) ReleaseJob(id uint, owner string) error {
+	return r.db.Model(&models.Job{}).Where("id = ? AND lease_owner = ?", id, owner).Updates(map[string]interface{}{
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	}).Error
+}
+
+// CompleteJob removes a finished job from the queue
+func (r *Repository) CompleteJob(id uint) error {
+	return r.db.Delete(&models.Job{}, id).Error
+}
+
+// DeleteJobForDownload removes any queued job for a download
+func (r *Repository) DeleteJobForDownload(downloadID uint) error {
+	return r.db.Where("download_id = ?", downloadID).Delete(&models.Job{}).Error
+}
+
+// GetQueuePositions returns the 1-based queue position of every download
+// whose job is waiting to be claimed
+func (r *Repository) GetQueuePositions() (map[uint]int, error) {
+	var jobs []models.Job
+	if err := waitingJobs(r.db, time.Now().UTC()).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	positions := make(map[uint]int, len(jobs))
+	for i, job := range jobs {
+		positions[job.DownloadID] = i + 1
+	}
+	return positions, nil
+}
+
+// GetQueuedDownloadIDs returns the downloads waiting in the queue, in the
+// order workers will claim them
+func (r *Repository) GetQueuedDownloadIDs() ([]uint, error) {
+	var jobs []models.Job
+	if err := waitingJobs(r.db, time.Now().UTC()).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.DownloadID
+	}
+	return ids, nil
+}
+
+// waitingJobs selects unclaimed jobs, highest download priority first and
+// oldest first among equals
+func waitingJobs(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Model(&models.Job{}).
+		Select("jobs.*").
+		Joins("LEFT JOIN downloads ON downloads.id = jobs.download_id").
+		Where("jobs.lease_expires_at IS NULL OR jobs.lease_expires_at < ?", now).
+		Order("COALESCE(downloads.priority, 0) DESC").
+		Order("jobs.id ASC")
+}
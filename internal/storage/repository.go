@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/ygncode/real-debrid-downloader/internal/models"
 	"gorm.io/gorm"
 )
@@ -46,6 +48,8 @@ func (r *Repository) GetActiveDownloads() ([]models.Download, error) {
 	if err := r.db.Where("status NOT IN ?", []models.DownloadStatus{
 		models.StatusComplete,
 		models.StatusError,
+		models.StatusCancelled,
+		models.StatusPartial,
 	}).Find(&downloads).Error; err != nil {
 		return nil, err
 	}
@@ -68,6 +72,37 @@ func (r *Repository) UpdateDownload(download *models.Download) error {
 	return r.db.Save(download).Error
 }
 
+// UpdateDownloadIfStatus saves a download only if its stored status is
+// still the given one, so a concurrent pause or cancel is not overwritten
+func (r *Repository) UpdateDownloadIfStatus(download *models.Download, status models.DownloadStatus) (bool, error) {
+	result := r.db.Model(download).Where("status = ?", status).Select("*").Updates(download)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetRemoteDownloads returns downloads that are waiting on Real-Debrid
+func (r *Repository) GetRemoteDownloads() ([]models.Download, error) {
+	var downloads []models.Download
+	if err := r.db.Where("status IN ?", []models.DownloadStatus{
+		models.StatusPending,
+		models.StatusProcessing,
+	}).Find(&downloads).Error; err != nil {
+		return nil, err
+	}
+	return downloads, nil
+}
+
+// GetDueRetries returns failed downloads whose automatic retry is due
+func (r *Repository) GetDueRetries(now time.Time) ([]models.Download, error) {
+	var downloads []models.Download
+	if err := r.db.Where("status IN ? AND next_retry_at IS NOT NULL AND next_retry_at <= ?", []models.DownloadStatus{
+		models.StatusError,
+		models.StatusPartial,
+	}, now).Find(&downloads).Error; err != nil {
+		return nil, err
+	}
+	return downloads, nil
+}
+
 func (r *Repository) UpdateDownloadStatus(id uint, status models.DownloadStatus) error {
 	return r.db.Model(&models.Download{}).Where("id = ?", id).Update("status", status).Error
 }
@@ -86,6 +121,40 @@ func (r *Repository) UpdateDownloadError(id uint, errorMsg string) error {
 	}).Error
 }
 
+// UpdateDownloadPriority sets the priority a download's job is claimed with
+func (r *Repository) UpdateDownloadPriority(id uint, priority int) error {
+	return r.db.Model(&models.Download{}).Where("id = ?", id).Update("priority", priority).Error
+}
+
+// GetPriorityRange returns the lowest and highest priority of any download
+func (r *Repository) GetPriorityRange() (int, int, error) {
+	var result struct {
+		Min int
+		Max int
+	}
+	err := r.db.Model(&models.Download{}).
+		Select("COALESCE(MIN(priority), 0) AS min, COALESCE(MAX(priority), 0) AS max").
+		Scan(&result).Error
+	return result.Min, result.Max, err
+}
+
+// ReorderDownloads gives the downloads descending priorities in the order given
+func (r *Repository) ReorderDownloads(ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&models.Download{}).Where("id = ?", id).Update("priority", len(ids)-i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (r *Repository) DeleteDownload(id uint) error {
-	return r.db.Delete(&models.Download{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("download_id = ?", id).Delete(&models.Job{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Download{}, id).Error
+	})
 }
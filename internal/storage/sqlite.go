@@ -16,7 +16,7 @@ func NewDatabase(dbPath string) (*gorm.DB, error) {
 	}
 
 	// Auto-migrate the schema
-	if err := db.AutoMigrate(&models.Download{}); err != nil {
+	if err := db.AutoMigrate(&models.Download{}, &models.Job{}, &models.LibraryFile{}, &models.LibraryEntry{}); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,214 @@
+// Package webvtt converts SubRip and SubStation Alpha subtitles to WebVTT,
+// the only text track format browsers play
+package webvtt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxSubtitleSize bounds the subtitle files read into memory
+const maxSubtitleSize = 16 << 20
+
+// Supported reports whether files with this extension can be converted
+func Supported(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".srt", ".ass", ".ssa", ".vtt":
+		return true
+	}
+	return false
+}
+
+// Convert writes the subtitles read from r, in the format named by the file
+// extension ext, to w as WebVTT
+func Convert(w io.Writer, r io.Reader, ext string) error {
+	data, err := io.ReadAll(io.LimitReader(r, maxSubtitleSize))
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	switch strings.ToLower(ext) {
+	case ".vtt":
+		_, err = io.WriteString(w, text)
+	case ".srt":
+		err = fromSRT(w, text)
+	case ".ass", ".ssa":
+		err = fromASS(w, text)
+	default:
+		err = fmt.Errorf("unsupported subtitle format %s", ext)
+	}
+	return err
+}
+
+// fontTag matches the <font> tags SubRip files use for colours, which
+// WebVTT has no equivalent for
+var fontTag = regexp.MustCompile(`(?i)</?font[^>]*>`)
+
+// srtTag matches the italic, bold and underline tags WebVTT shares with
+// SubRip, and srtEntity the character references both understand
+var (
+	srtTag    = regexp.MustCompile(`(?i)^</?[biu]>`)
+	srtEntity = regexp.MustCompile(`^&(?:amp|lt|gt|nbsp|lrm|rlm);`)
+)
+
+// fromSRT rewrites the timing lines of a SubRip file, which use a comma
+// before the milliseconds. Cue numbers stay as WebVTT cue identifiers.
+func fromSRT(w io.Writer, text string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, "-->") {
+			line = strings.ReplaceAll(line, ",", ".")
+		} else {
+			line = escapeSRT(fontTag.ReplaceAllString(line, ""))
+		}
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// escapeSRT escapes the characters of a SubRip text line that WebVTT
+// would read as markup, keeping the tags both formats share
+func escapeSRT(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case '<':
+			if tag := srtTag.FindString(line[i:]); tag != "" {
+				b.WriteString(strings.ToLower(tag))
+				i += len(tag) - 1
+				continue
+			}
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '&':
+			if entity := srtEntity.FindString(line[i:]); entity != "" {
+				b.WriteString(entity)
+				i += len(entity) - 1
+				continue
+			}
+			b.WriteString("&amp;")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+type cue struct {
+	start, end float64 // Seconds
+	text       string
+}
+
+// overrideTag matches SubStation style overrides such as {\i1} or {\pos(10,20)}
+var overrideTag = regexp.MustCompile(`\{[^}]*\}`)
+
+// fromASS reads the Dialogue lines of the [Events] section. Styling is
+// dropped, since WebVTT can't express most of it.
+func fromASS(w io.Writer, text string) error {
+	var cues []cue
+	inEvents := false
+	format := []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "format":
+			format = format[:0]
+			for _, field := range strings.Split(value, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(field)))
+			}
+		case "dialogue":
+			// Text is always the last field and may contain commas
+			fields := strings.SplitN(value, ",", len(format))
+			if len(fields) < len(format) {
+				continue
+			}
+			var c cue
+			var startOK, endOK bool
+			for i, name := range format {
+				switch name {
+				case "start":
+					c.start, startOK = assTime(fields[i])
+				case "end":
+					c.end, endOK = assTime(fields[i])
+				case "text":
+					c.text = assText(fields[i])
+				}
+			}
+			if startOK && endOK && c.end > c.start && c.text != "" {
+				cues = append(cues, c)
+			}
+		}
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].start < cues[j].start })
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		fmt.Fprintf(bw, "\n%s --> %s\n%s\n", timestamp(c.start), timestamp(c.end), c.text)
+	}
+	return bw.Flush()
+}
+
+// assTime parses H:MM:SS.cc
+func assTime(s string) (float64, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return float64(h*3600+m*60) + sec, true
+}
+
+// cueEscaper escapes the characters WebVTT cue text reserves for markup
+var cueEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// assText strips override tags and turns the SubStation line break and
+// hard space escapes into text
+func assText(s string) string {
+	s = overrideTag.ReplaceAllString(s, "")
+	s = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(s)
+	// Blank lines would end the cue early
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, cueEscaper.Replace(line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// timestamp formats seconds as HH:MM:SS.mmm
+func timestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
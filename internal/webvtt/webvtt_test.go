@@ -0,0 +1,122 @@
+package webvtt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// assHeader is the start of a SubStation Alpha file up to its events
+const assHeader = "[Script Info]\nTitle: Test\nScriptType: v4.00+\n\n" +
+	"[V4+ Styles]\nFormat: Name, Fontname, Fontsize\nStyle: Default,Arial,20\n\n" +
+	"[Events]\n"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		ext   string
+		input string
+		want  string
+	}{
+		{
+			name:  "srt timing",
+			ext:   ".srt",
+			input: "1\n00:00:01,500 --> 00:00:04,000\nHello, world\n\n2\n01:02:03,004 --> 01:02:05,000\nBye\n",
+			want:  "WEBVTT\n\n1\n00:00:01.500 --> 00:00:04.000\nHello, world\n\n2\n01:02:03.004 --> 01:02:05.000\nBye\n\n",
+		},
+		{
+			name:  "srt font tags",
+			ext:   ".SRT",
+			input: "1\n00:00:01,000 --> 00:00:02,000\n<font color=\"#ffff00\">Yellow</font> and <FONT face=x>plain</FONT>\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nYellow and plain\n\n",
+		},
+		{
+			name:  "srt crlf and bom",
+			ext:   ".srt",
+			input: "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nLine one\r\nLine two\r\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nLine one\nLine two\n\n",
+		},
+		{
+			name:  "srt escaping",
+			ext:   ".srt",
+			input: "1\n00:00:01,000 --> 00:00:02,000\nTom & Jerry <3 <I>always</I>\n<b>a &lt; b</b> > c\n",
+			want:  "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nTom &amp; Jerry &lt;3 <i>always</i>\n<b>a &lt; b</b> &gt; c\n\n",
+		},
+		{
+			name: "ass default format",
+			ext:  ".ass",
+			input: assHeader +
+				"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0,0,0,,Hello\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n",
+		},
+		{
+			name: "ass custom format and commas in text",
+			ext:  ".ssa",
+			input: assHeader +
+				"Format: Marked, Start, End, Style, Text\n" +
+				"Dialogue: Marked=0,0:01:00.25,0:01:02.00,Default,Well, well, well\n",
+			want: "WEBVTT\n\n00:01:00.250 --> 00:01:02.000\nWell, well, well\n",
+		},
+		{
+			name: "ass overrides and escapes",
+			ext:  ".ass",
+			input: assHeader +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\an8}{\\i1}Top{\\i0}\\Nsecond\\hline\\N\\N{\\pos(10,20)}third\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nTop\nsecond line\nthird\n",
+		},
+		{
+			name: "ass escaping",
+			ext:  ".ass",
+			input: assHeader +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Fish & chips <3\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFish &amp; chips &lt;3\n",
+		},
+		{
+			name: "ass out of order, invalid and empty lines",
+			ext:  ".ass",
+			input: assHeader +
+				"Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,Third\r\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,First\r\n" +
+				"Comment: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,Not shown\r\n" +
+				"Dialogue: 0,0:00:03.00,0:00:03.00,Default,,0,0,0,,Zero length\r\n" +
+				"Dialogue: 0,bad,0:00:03.00,Default,,0,0,0,,Bad time\r\n" +
+				"Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\\i1}{\\i0}\r\n" +
+				"Dialogue: 0,0:00:02.50,0:00:04.00,Default,,0,0,0,,Second\r\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFirst\n\n00:00:02.500 --> 00:00:04.000\nSecond\n\n00:00:05.000 --> 00:00:06.000\nThird\n",
+		},
+		{
+			name:  "ass dialogue outside events",
+			ext:   ".ass",
+			input: "[Script Info]\nDialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hidden\n",
+			want:  "WEBVTT\n",
+		},
+		{
+			name:  "vtt passthrough",
+			ext:   ".vtt",
+			input: "\ufeffWEBVTT\r\n\r\n00:00:01.000 --> 00:00:02.000 line:0\r\n<c.yellow>Hi</c>\r\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000 line:0\n<c.yellow>Hi</c>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Convert(&out, strings.NewReader(tt.input), tt.ext); err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Convert\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	if Supported(".sub") {
+		t.Error("Supported(.sub) = true")
+	}
+	if err := Convert(&bytes.Buffer{}, strings.NewReader("{1}{2}Hi"), ".sub"); err == nil {
+		t.Error("Convert of a .sub file succeeded")
+	}
+}
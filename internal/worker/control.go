@@ -0,0 +1,363 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+// stopTimeout bounds how long a control request waits for a worker to let go of a download
+const stopTimeout = 10 * time.Second
+
+var (
+	errPaused    = errors.New("download paused")
+	errCancelled = errors.New("download cancelled")
+)
+
+// activeJob is a download that a worker is currently processing
+type activeJob struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// track registers a download as being processed and returns its context.
+// The returned func must be called when the worker is done with it.
+func (m *Manager) track(id uint) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(m.ctx)
+	job := &activeJob{cancel: cancel, done: make(chan struct{})}
+
+	m.activeMu.Lock()
+	m.active[id] = job
+	m.activeMu.Unlock()
+
+	return ctx, func() {
+		m.activeMu.Lock()
+		if m.active[id] == job {
+			delete(m.active, id)
+		}
+		m.activeMu.Unlock()
+
+		cancel(nil)
+		close(job.done)
+	}
+}
+
+// stop interrupts the worker processing a download, if any, and waits for
+// it to return so it cannot overwrite the status set by the caller
+func (m *Manager) stop(id uint, cause error) {
+	m.activeMu.Lock()
+	job := m.active[id]
+	m.activeMu.Unlock()
+
+	if job == nil {
+		return
+	}
+
+	job.cancel(cause)
+
+	select {
+	case <-job.done:
+	case <-time.After(stopTimeout):
+		log.Printf("Timed out waiting for download %d to stop", id)
+	}
+}
+
+// interrupted reports whether work on a download was stopped on purpose,
+// either by a control request or by the manager shutting down
+func (m *Manager) interrupted(ctx context.Context) bool {
+	if m.ctx.Err() != nil {
+		return true
+	}
+	cause := context.Cause(ctx)
+	return errors.Is(cause, errPaused) || errors.Is(cause, errCancelled)
+}
+
+// Pause stops a download and frees its worker, keeping partial data so
+// that Resume continues where it left off
+func (m *Manager) Pause(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if !canPause(download.Status) {
+		return nil, fmt.Errorf("download cannot be paused while %s", download.Status)
+	}
+
+	// Paused downloads give up their place in the queue. The job goes
+	// first, so another worker can't claim it once this one lets go.
+	m.repo.DeleteJobForDownload(id)
+	m.stop(id, errPaused)
+
+	// The worker may have moved the download on before it stopped
+	if download, err = m.repo.GetDownload(id); err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if !canPause(download.Status) {
+		return nil, fmt.Errorf("download cannot be paused while %s", download.Status)
+	}
+
+	// A worker that outlived stopTimeout only saves while the status is
+	// unchanged, and so does this
+	from := download.Status
+	download.Status = models.StatusPaused
+	if ok, err := m.repo.UpdateDownloadIfStatus(download, from); err != nil {
+		return nil, fmt.Errorf("failed to update download: %w", err)
+	} else if !ok {
+		return nil, fmt.Errorf("download changed while pausing")
+	}
+	// A worker that claimed the download just before the status changed
+	// may have started tracking it after the first stop
+	m.stop(id, errPaused)
+	m.Broadcast(download)
+	log.Printf("Paused download: %s", download.Name)
+
+	return download, nil
+}
+
+// Resume puts a paused download back into the phase it was paused in
+func (m *Manager) Resume(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if download.Status != models.StatusPaused {
+		return nil, fmt.Errorf("download is not paused")
+	}
+
+	download.Status = resumeStatus(download)
+	download.ErrorMessage = ""
+	if err := m.repo.UpdateDownload(download); err != nil {
+		return nil, fmt.Errorf("failed to update download: %w", err)
+	}
+	m.Broadcast(download)
+	log.Printf("Resumed download: %s", download.Name)
+
+	m.QueueDownload(download)
+	return download, nil
+}
+
+// RetryFailed downloads again only the files that failed last time
+func (m *Manager) RetryFailed(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if download.Status != models.StatusPartial && download.Status != models.StatusError {
+		return nil, fmt.Errorf("download has no failed files")
+	}
+
+	failed := 0
+	for _, result := range fileResults(download) {
+		if result.Status == models.FileResultFailed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil, fmt.Errorf("download has no failed files")
+	}
+
+	download.Status = models.StatusDownloading
+	download.ErrorMessage = ""
+	download.RetryCount = 0
+	download.NextRetryAt = nil
+	if err := m.repo.UpdateDownload(download); err != nil {
+		return nil, fmt.Errorf("failed to update download: %w", err)
+	}
+	m.Broadcast(download)
+	log.Printf("Retrying %d failed files of %s", failed, download.Name)
+
+	m.QueueDownload(download)
+	return download, nil
+}
+
+// Readd adds the download's original magnet or .torrent file to
+// Real-Debrid again under a new torrent ID and continues the same entry.
+// The previous file selection is applied once the new torrent is ready.
+func (m *Manager) Readd(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	switch download.Status {
+	case models.StatusDownloading, models.StatusSubtitles, models.StatusComplete, models.StatusCancelled:
+		return nil, fmt.Errorf("download cannot be re-added while %s", download.Status)
+	}
+	if !download.HasSource() {
+		return nil, fmt.Errorf("original magnet or torrent file was not saved")
+	}
+
+	var result *models.AddTorrentResponse
+	if download.Magnet != "" {
+		result, err = m.rdClient.AddMagnet(m.ctx, download.Magnet)
+	} else {
+		result, err = m.rdClient.AddTorrent(m.ctx, download.TorrentFilename, bytes.NewReader(download.TorrentData))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add torrent to Real-Debrid: %w", err)
+	}
+
+	from := download.Status
+	oldID := download.TorrentID
+
+	// Links and results belong to the old torrent. The files that finished
+	// are kept in FilePaths, so the new links skip them when they are still
+	// complete on disk, whatever the collision policy.
+	download.FilePaths = finishedPaths(download)
+	download.TorrentID = result.ID
+	download.Status = models.StatusPending
+	download.Progress = 0
+	download.ErrorMessage = ""
+	download.Links = ""
+	download.FileResults = ""
+	download.RetryCount = 0
+	download.NextRetryAt = nil
+	if !m.transition(download, from) {
+		m.rdClient.DeleteTorrent(m.ctx, result.ID)
+		return nil, fmt.Errorf("download changed while re-adding")
+	}
+	m.repo.DeleteJobForDownload(id)
+
+	// The old torrent is dead or gone, don't leave it on the account
+	if err := m.rdClient.DeleteTorrent(m.ctx, oldID); err != nil {
+		log.Printf("Failed to delete old torrent %s: %v", oldID, err)
+	}
+
+	log.Printf("Re-added %s to Real-Debrid as %s", download.Name, result.ID)
+	m.QueueDownload(download)
+	return download, nil
+}
+
+// finishedPaths returns the files a download has written so far: those of
+// its last completed run and any that finished since
+func finishedPaths(download *models.Download) string {
+	paths := filePaths(download)
+	var since []string
+	for _, result := range fileResults(download) {
+		if result.Status == models.FileResultOK && !slices.Contains(paths, result.Path) {
+			since = append(since, result.Path)
+		}
+	}
+	slices.Sort(since)
+	paths = append(paths, since...)
+	if len(paths) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(paths)
+	return string(data)
+}
+
+// Cancel stops a download for good and removes its partial files
+func (m *Manager) Cancel(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if err := checkCancel(download.Status); err != nil {
+		return nil, err
+	}
+
+	m.repo.DeleteJobForDownload(id)
+	m.stop(id, errCancelled)
+
+	// The worker may have finished the download before it stopped
+	if download, err = m.repo.GetDownload(id); err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if err := checkCancel(download.Status); err != nil {
+		return nil, err
+	}
+
+	from := download.Status
+	download.Status = models.StatusCancelled
+	if ok, err := m.repo.UpdateDownloadIfStatus(download, from); err != nil {
+		return nil, fmt.Errorf("failed to update download: %w", err)
+	} else if !ok {
+		return nil, fmt.Errorf("download changed while cancelling")
+	}
+	m.stop(id, errCancelled)
+	m.removePartials(download)
+	m.Broadcast(download)
+	log.Printf("Cancelled download: %s", download.Name)
+
+	return download, nil
+}
+
+// removePartials deletes the .part files left behind by a download, along
+// with its torrent folder if nothing else is in it
+func (m *Manager) removePartials(download *models.Download) {
+	folder, err := m.torrentFolder(download)
+	if err != nil {
+		log.Printf("Not removing partial files of %s: %v", download.Name, err)
+		return
+	}
+
+	filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, partSuffix) {
+			return nil
+		}
+		if err := discardPart(path); err != nil {
+			log.Printf("Failed to remove partial file %s: %v", path, err)
+		}
+		return nil
+	})
+
+	removeEmptyDirs(folder)
+}
+
+// removeEmptyDirs removes dir and any folders below it that hold no files
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, entry.Name()))
+		}
+	}
+	os.Remove(dir) // Fails unless empty
+}
+
+// checkCancel explains why a download can't be cancelled, if it can't
+func checkCancel(status models.DownloadStatus) error {
+	switch status {
+	case models.StatusComplete, models.StatusCancelled, models.StatusPartial:
+		return fmt.Errorf("download is already %s", status)
+	case models.StatusSubtitles:
+		return fmt.Errorf("download is already finishing")
+	}
+	return nil
+}
+
+// canPause reports whether a download in the given status is still being worked on
+func canPause(status models.DownloadStatus) bool {
+	switch status {
+	case models.StatusPending, models.StatusProcessing, models.StatusDownloading:
+		return true
+	}
+	return false
+}
+
+// resumeStatus works out which phase a download should continue from
+// based on how far it got
+func resumeStatus(download *models.Download) models.DownloadStatus {
+	switch {
+	case download.Links != "":
+		return models.StatusDownloading
+	case download.SelectedIDs != "":
+		return models.StatusProcessing
+	default:
+		return models.StatusPending
+	}
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ygncode/real-debrid-downloader/internal/config"
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/sandbox"
+)
+
+// torrentFolder returns the library folder a download's files go into,
+// named after the torrent
+func (m *Manager) torrentFolder(download *models.Download) (string, error) {
+	library, err := m.libraries.Root(download.Library)
+	if err != nil {
+		return "", err
+	}
+	return library.Join(folderName(download))
+}
+
+// destinationPath returns where a file is written inside the torrent
+// folder. relPath is the file's path within the torrent, when known,
+// otherwise the file name Real-Debrid reported is used.
+func (m *Manager) destinationPath(download *models.Download, relPath, filename string) (string, error) {
+	if relPath == "" {
+		relPath = filename
+	}
+	library, err := m.libraries.Root(download.Library)
+	if err != nil {
+		return "", err
+	}
+	return library.Join(folderName(download), relPath)
+}
+
+// folderName derives a folder name from the torrent name
+func folderName(download *models.Download) string {
+	name := download.Name
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".torrent" || isVideoFile(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if sandbox.SanitizeName(name) == "" {
+		name = fmt.Sprintf("download-%d", download.ID)
+	}
+	return name
+}
+
+// placement is what becomes of a file whose destination may already exist
+type placement int
+
+const (
+	placeWrite    placement = iota // Download it to the returned path
+	placeFinished                  // The file is there already, count it as downloaded
+	placeSkipped                   // Keep the file in the way and skip the download
+)
+
+// placeFile decides where a file of the given size goes. A complete copy
+// that the download wrote in an earlier run, as before it was re-added,
+// counts as downloaded whatever the collision policy. Anything else in the
+// way is left to resolveCollision.
+func (m *Manager) placeFile(destPath string, size int64, previous map[string]bool) (string, placement) {
+	if previous[destPath] && size > 0 {
+		if info, err := os.Stat(destPath); err == nil && !info.IsDir() && info.Size() == size {
+			return destPath, placeFinished
+		}
+	}
+
+	path, keep := m.resolveCollision(destPath, size)
+	switch {
+	case !keep:
+		return path, placeWrite
+	case m.onCollision == config.CollisionSkip:
+		return path, placeSkipped
+	default:
+		// Same size under the size policy, most likely finished by a
+		// previous run
+		return path, placeFinished
+	}
+}
+
+// resolveCollision applies the collision policy to a destination that may
+// already exist. It returns the path to write to, or skip when the existing
+// file is kept.
+func (m *Manager) resolveCollision(destPath string, size int64) (path string, skip bool) {
+	info, err := os.Stat(destPath)
+	if err != nil {
+		return destPath, false
+	}
+
+	switch m.onCollision {
+	case config.CollisionSkip:
+		return destPath, true
+	case config.CollisionOverwrite:
+		return destPath, false
+	case config.CollisionSize:
+		if size > 0 && !info.IsDir() && info.Size() == size {
+			return destPath, true
+		}
+	}
+	return freeName(destPath), false
+}
+
+// freeName finds the first "name (n).ext" next to path that is not taken
+func freeName(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ygncode/real-debrid-downloader/internal/config"
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+func TestPlaceFile(t *testing.T) {
+	policies := []string{config.CollisionSkip, config.CollisionRename, config.CollisionOverwrite, config.CollisionSize}
+
+	tests := []struct {
+		name     string
+		existing int64 // Size of the file already there, -1 for none
+		previous bool  // Whether an earlier run of the download wrote it
+		want     map[string]placement
+		wantPath map[string]string // "" for the destination itself
+	}{
+		{
+			name:     "nothing there",
+			existing: -1,
+			want: map[string]placement{
+				config.CollisionSkip: placeWrite, config.CollisionRename: placeWrite,
+				config.CollisionOverwrite: placeWrite, config.CollisionSize: placeWrite,
+			},
+		},
+		{
+			// As after a re-add: the download's own file is kept under every policy
+			name:     "finished by an earlier run",
+			existing: 100,
+			previous: true,
+			want: map[string]placement{
+				config.CollisionSkip: placeFinished, config.CollisionRename: placeFinished,
+				config.CollisionOverwrite: placeFinished, config.CollisionSize: placeFinished,
+			},
+		},
+		{
+			name:     "earlier run's file is incomplete",
+			existing: 40,
+			previous: true,
+			want: map[string]placement{
+				config.CollisionSkip: placeSkipped, config.CollisionRename: placeWrite,
+				config.CollisionOverwrite: placeWrite, config.CollisionSize: placeWrite,
+			},
+			wantPath: map[string]string{config.CollisionRename: "Movie (1).mkv", config.CollisionSize: "Movie (1).mkv"},
+		},
+		{
+			name:     "someone else's file of the same size",
+			existing: 100,
+			want: map[string]placement{
+				config.CollisionSkip: placeSkipped, config.CollisionRename: placeWrite,
+				config.CollisionOverwrite: placeWrite, config.CollisionSize: placeFinished,
+			},
+			wantPath: map[string]string{config.CollisionRename: "Movie (1).mkv"},
+		},
+		{
+			name:     "someone else's file of another size",
+			existing: 40,
+			want: map[string]placement{
+				config.CollisionSkip: placeSkipped, config.CollisionRename: placeWrite,
+				config.CollisionOverwrite: placeWrite, config.CollisionSize: placeWrite,
+			},
+			wantPath: map[string]string{config.CollisionRename: "Movie (1).mkv", config.CollisionSize: "Movie (1).mkv"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, policy := range policies {
+			t.Run(tt.name+"/"+policy, func(t *testing.T) {
+				dir := t.TempDir()
+				dest := filepath.Join(dir, "Movie.mkv")
+				if tt.existing >= 0 {
+					if err := os.WriteFile(dest, make([]byte, tt.existing), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				previous := map[string]bool{}
+				if tt.previous {
+					previous[dest] = true
+				}
+
+				m := &Manager{onCollision: policy}
+				path, place := m.placeFile(dest, 100, previous)
+				if place != tt.want[policy] {
+					t.Errorf("placement = %d, want %d", place, tt.want[policy])
+				}
+				want := dest
+				if name := tt.wantPath[policy]; name != "" {
+					want = filepath.Join(dir, name)
+				}
+				if path != want {
+					t.Errorf("path = %s, want %s", path, want)
+				}
+			})
+		}
+	}
+}
+
+func TestFinishedPaths(t *testing.T) {
+	download := &models.Download{
+		FilePaths: `["/lib/Show/E01.mkv"]`,
+		FileResults: `[` +
+			`{"link":"a","status":"ok","path":"/lib/Show/E01.mkv"},` +
+			`{"link":"b","status":"failed","path":""},` +
+			`{"link":"c","status":"ok","path":"/lib/Show/E03.mkv"},` +
+			`{"link":"d","status":"ok","path":"/lib/Show/E02.mkv"}]`,
+	}
+	want := `["/lib/Show/E01.mkv","/lib/Show/E02.mkv","/lib/Show/E03.mkv"]`
+	if got := finishedPaths(download); got != want {
+		t.Errorf("finishedPaths = %s, want %s", got, want)
+	}
+
+	if got := finishedPaths(&models.Download{}); got != "" {
+		t.Errorf("finishedPaths of a fresh download = %q", got)
+	}
+}
@@ -3,137 +3,62 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/services"
 )
 
-func (m *Manager) processDownload(download *models.Download) {
-	log.Printf("Processing download: %s (status: %s)", download.Name, download.Status)
-
-	switch download.Status {
-	case models.StatusPending:
-		m.pollUntilFilesReady(download)
-	case models.StatusProcessing:
-		m.pollUntilDownloaded(download)
-	case models.StatusDownloading:
-		m.downloadFiles(download)
-	}
-}
-
-// pollUntilFilesReady polls Real-Debrid until files are ready for selection
-func (m *Manager) pollUntilFilesReady(download *models.Download) {
-	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Minute)
-	defer cancel()
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			m.setError(download, "Timeout waiting for torrent to be ready")
-			return
-		case <-ticker.C:
-			info, err := m.rdClient.GetTorrentInfo(ctx, download.TorrentID)
-			if err != nil {
-				log.Printf("Error getting torrent info: %v", err)
-				continue
-			}
+const (
+	// partSuffix marks files that are still being downloaded
+	partSuffix = ".part"
 
-			// Update name if we got it from the API
-			if info.Filename != "" && download.Name == "Processing..." {
-				download.Name = info.Filename
-				m.repo.UpdateDownload(download)
-				m.Broadcast(download)
-			}
+	// maxTransferAttempts is how many times a single file transfer is
+	// resumed after a dropped connection before giving up
+	maxTransferAttempts = 5
+	transferRetryDelay  = 5 * time.Second
+)
 
-			switch info.Status {
-			case models.RDStatusWaitingFilesSelection:
-				// Files are ready for selection
-				filesJSON, _ := json.Marshal(info.Files)
-				download.FilesJSON = string(filesJSON)
-				download.Status = models.StatusAwaitingSelection
-				download.TotalSize = info.Bytes
-				m.repo.UpdateDownload(download)
-				m.Broadcast(download)
-				log.Printf("Torrent %s ready for file selection", download.Name)
-				return
+// processDownload does the local work for a download. Waiting on
+// Real-Debrid is handled by the poller, which only queues a job once
+// there is something to transfer.
+func (m *Manager) processDownload(download *models.Download) {
+	log.Printf("Processing download: %s (status: %s)", download.Name, download.Status)
 
-			case models.RDStatusMagnetError, models.RDStatusError, models.RDStatusVirus, models.RDStatusDead:
-				m.setError(download, fmt.Sprintf("Torrent error: %s", info.Status))
-				return
+	ctx, done := m.track(download.ID)
+	defer done()
 
-			case models.RDStatusMagnetConversion:
-				log.Printf("Torrent %s: converting magnet...", download.Name)
-			}
-		}
+	// A pause or cancel before the download was tracked had no worker to
+	// stop, so check it is still in the state it was claimed in
+	current, err := m.repo.GetDownload(download.ID)
+	if err != nil || current.Status != download.Status {
+		log.Printf("Not processing %s, it changed before it started", download.Name)
+		return
 	}
-}
-
-// pollUntilDownloaded polls Real-Debrid until the torrent is fully downloaded
-func (m *Manager) pollUntilDownloaded(download *models.Download) {
-	ctx, cancel := context.WithTimeout(m.ctx, 24*time.Hour)
-	defer cancel()
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			m.setError(download, "Timeout waiting for torrent download")
-			return
-		case <-ticker.C:
-			info, err := m.rdClient.GetTorrentInfo(ctx, download.TorrentID)
-			if err != nil {
-				log.Printf("Error getting torrent info: %v", err)
-				continue
-			}
-
-			// Update progress
-			download.Progress = info.Progress
-			m.repo.UpdateDownload(download)
-			m.Broadcast(download)
-
-			switch info.Status {
-			case models.RDStatusDownloaded:
-				// Torrent is ready, store links and start downloading
-				linksJSON, _ := json.Marshal(info.Links)
-				download.Links = string(linksJSON)
-				download.Status = models.StatusDownloading
-				download.Progress = 0 // Reset progress for file download phase
-				m.repo.UpdateDownload(download)
-				m.Broadcast(download)
-				log.Printf("Torrent %s downloaded on Real-Debrid, starting file download", download.Name)
-				m.downloadFiles(download)
-				return
 
-			case models.RDStatusMagnetError, models.RDStatusError, models.RDStatusVirus, models.RDStatusDead:
-				m.setError(download, fmt.Sprintf("Torrent error: %s", info.Status))
-				return
-
-			case models.RDStatusQueued:
-				log.Printf("Torrent %s: queued on Real-Debrid", download.Name)
-
-			case models.RDStatusDownloading:
-				log.Printf("Torrent %s: downloading %.1f%%", download.Name, info.Progress)
-			}
-		}
+	switch download.Status {
+	case models.StatusDownloading:
+		m.downloadFiles(ctx, download)
+	default:
+		log.Printf("Nothing to do for %s while %s", download.Name, download.Status)
 	}
 }
 
-// downloadFiles downloads all files from the unrestricted links
-func (m *Manager) downloadFiles(download *models.Download) {
-	ctx := m.ctx
-
+// downloadFiles downloads all files from the unrestricted links. Files
+// that already succeeded in an earlier run are skipped, so this also
+// retries just the failed files of a partial download.
+func (m *Manager) downloadFiles(ctx context.Context, download *models.Download) {
 	// Parse links from JSON
 	var links []string
 	if err := json.Unmarshal([]byte(download.Links), &links); err != nil {
@@ -146,29 +71,93 @@ func (m *Manager) downloadFiles(download *models.Download) {
 		return
 	}
 
-	var downloadedPaths []string
+	// Pick the library once, so retried files land next to the others
+	if download.Library == "" {
+		download.Library = m.libraries.Route(download)
+		log.Printf("Routing %s to library %s", download.Name, download.Library)
+		m.repo.UpdateDownloadIfStatus(download, models.StatusDownloading)
+	}
+
+	results := fileResults(download)
+	paths := linkPaths(download, len(links))
+
+	previous := make(map[string]bool) // Files written by earlier runs
+	for _, path := range filePaths(download) {
+		previous[path] = true
+	}
+
 	var videoPaths []string
 	totalLinks := len(links)
+	transient := false // Whether any failure is worth retrying automatically
 
 	for i, link := range links {
+		if prev, ok := results[link]; ok && prev.Status != models.FileResultFailed {
+			continue
+		}
+
+		name := filepath.Base(paths[i])
+		if paths[i] == "" {
+			name = fmt.Sprintf("file %d", i+1)
+		}
+		result := models.FileResult{Link: link, Name: name, Status: models.FileResultFailed}
+
 		// Unrestrict the link
 		unrestricted, err := m.rdClient.UnrestrictLink(ctx, link)
+		if m.interrupted(ctx) {
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to unrestrict link %s: %v", link, err)
+			result.Error = err.Error()
+			transient = transient || isTransient(err)
+			m.recordResult(download, results, result)
 			continue
 		}
 
-		// Download the file
-		destPath := filepath.Join(m.moviesPath, unrestricted.Filename)
-		log.Printf("Downloading %s to %s", unrestricted.Filename, destPath)
-
-		err = m.downloadFile(ctx, download, unrestricted.Download, destPath, unrestricted.Filesize, i, totalLinks)
+		result.Name = unrestricted.Filename
+		destPath, err := m.destinationPath(download, paths[i], unrestricted.Filename)
 		if err != nil {
-			log.Printf("Failed to download %s: %v", unrestricted.Filename, err)
+			log.Printf("Refusing to write %s: %v", unrestricted.Filename, err)
+			result.Error = err.Error()
+			m.recordResult(download, results, result)
+			continue
+		}
+		destPath, place := m.placeFile(destPath, unrestricted.Filesize, previous)
+
+		if place == placeSkipped {
+			log.Printf("Skipping %s, %s already exists", unrestricted.Filename, destPath)
+			result.Status = models.FileResultSkipped
+			result.Path = destPath
+			result.Error = ""
+			m.recordResult(download, results, result)
 			continue
 		}
 
-		downloadedPaths = append(downloadedPaths, destPath)
+		if place == placeFinished {
+			log.Printf("Skipping %s, already downloaded", unrestricted.Filename)
+		} else {
+			// Download the file
+			log.Printf("Downloading %s to %s", unrestricted.Filename, destPath)
+
+			err = m.downloadFile(ctx, download, unrestricted, destPath, i, totalLinks)
+			if m.interrupted(ctx) {
+				// Keep the partial file so the download can be resumed
+				log.Printf("Stopped downloading %s: %v", unrestricted.Filename, context.Cause(ctx))
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to download %s: %v", unrestricted.Filename, err)
+				result.Error = err.Error()
+				transient = transient || isTransient(err)
+				m.recordResult(download, results, result)
+				continue
+			}
+		}
+
+		result.Status = models.FileResultOK
+		result.Path = destPath
+		result.Error = ""
+		m.recordResult(download, results, result)
 
 		// Track video files for subtitle download
 		if isVideoFile(destPath) {
@@ -176,57 +165,295 @@ func (m *Manager) downloadFiles(download *models.Download) {
 		}
 	}
 
-	// Update paths
+	// Update paths and collect failures, in link order
+	var downloadedPaths, failed []string
+	for _, link := range links {
+		result, ok := results[link]
+		switch {
+		case !ok:
+		case result.Status == models.FileResultOK:
+			downloadedPaths = append(downloadedPaths, result.Path)
+		case result.Status == models.FileResultFailed:
+			failed = append(failed, result.Name)
+		}
+	}
 	pathsJSON, _ := json.Marshal(downloadedPaths)
 	download.FilePaths = string(pathsJSON)
 
+	// The status the download was last saved with. Saves below only go
+	// through while it still has it, so a pause or cancel that happens
+	// meanwhile is not overwritten.
+	from := models.StatusDownloading
+
 	// Download subtitles if enabled
 	if download.DownloadSubs && len(videoPaths) > 0 && m.subtitleService.IsAvailable() {
 		download.Status = models.StatusSubtitles
 		download.SubtitleStatus = "Downloading subtitles..."
 		download.Progress = 100
-		m.repo.UpdateDownload(download)
-		m.Broadcast(download)
+		if !m.transition(download, from) {
+			log.Printf("Not fetching subtitles for %s, it changed meanwhile", download.Name)
+			return
+		}
+		from = models.StatusSubtitles
 
+		languages := download.SubtitleLanguages()
+		if len(languages) == 0 {
+			languages = m.subLanguages
+		}
+
+		// One entry per video, such as "Movie.mkv: en ok, my none found"
 		subtitleResults := []string{}
 		for _, videoPath := range videoPaths {
-			log.Printf("Downloading subtitles for %s", videoPath)
-			if err := m.subtitleService.DownloadSubtitles(videoPath); err != nil {
-				log.Printf("Failed to download subtitles for %s: %v", videoPath, err)
-				subtitleResults = append(subtitleResults, fmt.Sprintf("%s: failed", filepath.Base(videoPath)))
-			} else {
-				subtitleResults = append(subtitleResults, fmt.Sprintf("%s: ok", filepath.Base(videoPath)))
+			if ctx.Err() != nil {
+				// Shutting down; the files themselves are done, so the
+				// outcome is still saved below
+				subtitleResults = append(subtitleResults, "stopped before the rest")
+				break
+			}
+			var outcomes []string
+			for _, result := range m.subtitleService.DownloadSubtitles(ctx, videoPath, languages) {
+				if result.Err != nil && !errors.Is(result.Err, services.ErrNoSubtitles) {
+					log.Printf("Failed to download %s subtitles for %s: %v", result.Language, videoPath, result.Err)
+				}
+				outcomes = append(outcomes, result.Language+" "+result.Status())
 			}
+			subtitleResults = append(subtitleResults, fmt.Sprintf("%s: %s", filepath.Base(videoPath), strings.Join(outcomes, ", ")))
 		}
-		download.SubtitleStatus = strings.Join(subtitleResults, ", ")
+		download.SubtitleStatus = strings.Join(subtitleResults, "; ")
 	} else if download.DownloadSubs && !m.subtitleService.IsAvailable() {
-		download.SubtitleStatus = "Skipped (subliminal not installed)"
+		download.SubtitleStatus = "Skipped (no subtitle provider available)"
 	} else if !download.DownloadSubs {
 		download.SubtitleStatus = "Disabled"
 	}
 
 	// Update final status
-	download.Status = models.StatusComplete
-	download.Progress = 100
-	m.repo.UpdateDownload(download)
-	m.Broadcast(download)
-	log.Printf("Download complete: %s", download.Name)
+	switch {
+	case len(failed) == 0:
+		download.Status = models.StatusComplete
+		download.ErrorMessage = ""
+		download.Progress = 100
+		download.RetryCount = 0
+		log.Printf("Download complete: %s", download.Name)
+	case len(failed) == totalLinks:
+		download.Status = models.StatusError
+		download.ErrorMessage = fmt.Sprintf("All files failed: %s", strings.Join(failed, ", "))
+		download.Progress = 0
+		log.Printf("Download failed: %s", download.Name)
+	default:
+		download.Status = models.StatusPartial
+		download.ErrorMessage = fmt.Sprintf("%d of %d files failed: %s", len(failed), totalLinks, strings.Join(failed, ", "))
+		download.Progress = float64(totalLinks-len(failed)) / float64(totalLinks) * 100
+		log.Printf("Download partially complete: %s (%d failed)", download.Name, len(failed))
+	}
+	download.NextRetryAt = nil
+	if len(failed) > 0 && transient {
+		m.scheduleRetry(download)
+	}
+
+	if m.autoOrganize && canOrganize(download.Status) {
+		if err := m.organize(download); err != nil {
+			log.Printf("Failed to organize %s: %v", download.Name, err)
+		}
+	}
+	m.refreshCatalog(download)
+	if !m.transition(download, from) {
+		log.Printf("Not saving the outcome of %s, it changed meanwhile", download.Name)
+	}
+}
+
+// recordResult stores the outcome of one file so it survives restarts
+func (m *Manager) recordResult(download *models.Download, results map[string]models.FileResult, result models.FileResult) {
+	results[result.Link] = result
+
+	list := make([]models.FileResult, 0, len(results))
+	for _, r := range results {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Link < list[j].Link })
+
+	resultsJSON, _ := json.Marshal(list)
+	download.FileResults = string(resultsJSON)
+	m.repo.UpdateDownloadIfStatus(download, models.StatusDownloading)
+}
+
+// filePaths returns the paths of the files a download recorded as downloaded
+func filePaths(download *models.Download) []string {
+	var paths []string
+	if download.FilePaths != "" {
+		json.Unmarshal([]byte(download.FilePaths), &paths)
+	}
+	return paths
+}
+
+// fileResults returns the recorded file outcomes of a download keyed by link
+func fileResults(download *models.Download) map[string]models.FileResult {
+	results := make(map[string]models.FileResult)
+	if download.FileResults == "" {
+		return results
+	}
+
+	var list []models.FileResult
+	if err := json.Unmarshal([]byte(download.FileResults), &list); err != nil {
+		return results
+	}
+	for _, r := range list {
+		results[r.Link] = r
+	}
+	return results
+}
+
+// linkPaths returns the path within the torrent of the file behind each
+// link, or "" where it cannot be told. Real-Debrid returns one link per
+// selected file, in file ID order, unless it packed the files together.
+func linkPaths(download *models.Download, count int) []string {
+	paths := make([]string, count)
+
+	var files []models.TorrentFile
+	if download.FilesJSON == "" || json.Unmarshal([]byte(download.FilesJSON), &files) != nil {
+		return paths
+	}
+
+	selected := make(map[string]bool)
+	for _, id := range strings.Split(download.SelectedIDs, ",") {
+		selected[strings.TrimSpace(id)] = true
+	}
+
+	var picked []models.TorrentFile
+	for _, f := range files {
+		if selected["all"] || selected[strconv.Itoa(f.ID)] {
+			picked = append(picked, f)
+		}
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].ID < picked[j].ID })
+
+	if len(picked) != count {
+		return paths
+	}
+	for i, f := range picked {
+		paths[i] = strings.TrimPrefix(f.Path, "/")
+	}
+	return paths
+}
+
+// downloadFile downloads a single file with progress tracking. Data is
+// written to a .part file next to destPath so an interrupted transfer can
+// continue from where it stopped, and the file is renamed into place once
+// it is complete. Large files are fetched over several connections when
+// the host allows it.
+func (m *Manager) downloadFile(ctx context.Context, download *models.Download, link *models.UnrestrictedLink, destPath string, linkIndex, totalLinks int) error {
+	partPath := destPath + partSuffix
+	name := filepath.Base(destPath)
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	n := m.segmentCount(link)
+	segmented := hasSegmentState(partPath)
+	if !segmented && link.Filesize > 0 {
+		// A full size .part without segment state may be a preallocated
+		// file whose transfer never started, all zeros, so it can't be
+		// trusted as finished
+		if info, err := os.Stat(partPath); err == nil && info.Size() == link.Filesize {
+			log.Printf("Discarding %s, its size can't tell whether it finished", filepath.Base(partPath))
+			if err := discardPart(partPath); err != nil {
+				return err
+			}
+		}
+	}
+	if !segmented && n > 1 {
+		// A partial file without segment state came from a single
+		// connection, so keep appending to it
+		info, err := os.Stat(partPath)
+		segmented = err != nil || info.Size() == 0
+	}
+
+	var err error
+	if segmented {
+		err = m.downloadSegmented(ctx, download, link, partPath, n, linkIndex, totalLinks)
+		if errors.Is(err, errRangesUnsupported) {
+			log.Printf("Host does not support ranges for %s, using a single connection", name)
+			if err = discardPart(partPath); err != nil {
+				return err
+			}
+			err = retryTransfer(ctx, name, func() error {
+				return m.transferPart(ctx, download, link.Download, partPath, link.Filesize, linkIndex, totalLinks)
+			})
+		}
+	} else {
+		err = retryTransfer(ctx, name, func() error {
+			return m.transferPart(ctx, download, link.Download, partPath, link.Filesize, linkIndex, totalLinks)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		return fmt.Errorf("failed to finalize file: %w", err)
+	}
+
+	return nil
 }
 
-// downloadFile downloads a single file with progress tracking
-func (m *Manager) downloadFile(ctx context.Context, download *models.Download, url, destPath string, totalSize int64, linkIndex, totalLinks int) error {
-	// Create the destination file
-	out, err := os.Create(destPath)
+// retryTransfer runs fn until it succeeds, hits an error that resuming
+// cannot fix, or runs out of attempts
+func retryTransfer(ctx context.Context, name string, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxTransferAttempts; attempt++ {
+		err = fn()
+		if err == nil || ctx.Err() != nil || !isResumable(err) {
+			return err
+		}
+
+		if attempt < maxTransferAttempts {
+			delay := time.Duration(attempt) * transferRetryDelay
+			log.Printf("Transfer of %s interrupted (attempt %d/%d): %v, resuming in %s",
+				name, attempt, maxTransferAttempts, err, delay)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+	}
+	return err
+}
+
+// transferPart appends the remaining bytes of url to partPath, asking the
+// server for a byte range when some data is already on disk.
+func (m *Manager) transferPart(ctx context.Context, download *models.Download, url, partPath string, totalSize int64, linkIndex, totalLinks int) error {
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	defer out.Close()
 
+	// The size of the .part file is the persisted resume offset
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	if totalSize > 0 && offset == totalSize {
+		return nil
+	}
+	if totalSize > 0 && offset > totalSize {
+		log.Printf("Partial file %s is larger than expected, restarting", partPath)
+		if offset, err = restartPart(out); err != nil {
+			return err
+		}
+	}
+
 	// Start download request
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -234,49 +461,151 @@ func (m *Manager) downloadFile(ctx context.Context, download *models.Download, u
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			// Start over rather than splice mismatched bytes into the file
+			if _, err := restartPart(out); err != nil {
+				return err
+			}
+			return fmt.Errorf("unexpected content range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		log.Printf("Resuming %s at byte %d", filepath.Base(partPath), offset)
+
+	case http.StatusOK:
+		// The server ignored the range, so the body starts at byte zero
+		if offset > 0 {
+			log.Printf("Server does not support ranges for %s, restarting", filepath.Base(partPath))
+			if offset, err = restartPart(out); err != nil {
+				return err
+			}
+		}
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing left to fetch when the size is unknown, otherwise the
+		// partial file no longer matches the remote one
+		if totalSize == 0 {
+			return nil
+		}
+		if _, err := restartPart(out); err != nil {
+			return err
+		}
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+
+	default:
+		return &statusError{code: resp.StatusCode, status: resp.Status}
 	}
 
 	// Use content-length if available
 	if totalSize == 0 && resp.ContentLength > 0 {
-		totalSize = resp.ContentLength
+		totalSize = offset + resp.ContentLength
 	}
 
+	download.Downloaded = offset
+
 	// Create progress writer
 	pw := &progressWriter{
-		writer:      out,
-		total:       totalSize,
-		download:    download,
-		manager:     m,
-		linkIndex:   linkIndex,
-		totalLinks:  totalLinks,
-		lastUpdate:  time.Now(),
+		writer:     out,
+		total:      totalSize,
+		written:    offset,
+		download:   download,
+		manager:    m,
+		linkIndex:  linkIndex,
+		totalLinks: totalLinks,
+		lastUpdate: time.Now(),
 	}
 
 	// Copy with progress tracking
-	_, err = io.Copy(pw, resp.Body)
-	if err != nil {
+	if _, err := io.Copy(pw, resp.Body); err != nil {
 		return fmt.Errorf("download failed: %w", err)
 	}
 
+	if totalSize > 0 && pw.written < totalSize {
+		return fmt.Errorf("download failed: %w", io.ErrUnexpectedEOF)
+	}
+
 	return nil
 }
 
+// restartPart discards the contents of a partial file
+func restartPart(f *os.File) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, fmt.Errorf("failed to truncate file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek file: %w", err)
+	}
+	return 0, nil
+}
+
+// contentRangeStart returns the first byte position of a Content-Range
+// header such as "bytes 100-199/200"
+func contentRangeStart(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// statusError is returned when a file host answers with an unexpected status
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("bad status: %s", e.status)
+}
+
+// isResumable reports whether a failed transfer is worth resuming. Client
+// errors from the host will not go away by asking again.
+func isResumable(err error) bool {
+	if errors.Is(err, errRangesUnsupported) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusRequestedRangeNotSatisfiable || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// progressWriter reports the progress of a file transfer. It is shared by
+// all connections of a segmented download, so updates are serialized.
 type progressWriter struct {
-	writer      io.Writer
-	total       int64
-	written     int64
-	download    *models.Download
-	manager     *Manager
-	linkIndex   int
-	totalLinks  int
-	lastUpdate  time.Time
+	writer     io.Writer
+	total      int64
+	written    int64
+	download   *models.Download
+	manager    *Manager
+	linkIndex  int
+	totalLinks int
+	lastUpdate time.Time
+	mu         sync.Mutex
 }
 
 func (pw *progressWriter) Write(p []byte) (int, error) {
 	n, err := pw.writer.Write(p)
-	pw.written += int64(n)
+	pw.add(int64(n))
+	return n, err
+}
+
+// add records n more bytes written and publishes progress at most once a second
+func (pw *progressWriter) add(n int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.written += n
 
 	// Update progress every second
 	if time.Since(pw.lastUpdate) > time.Second {
@@ -294,16 +623,14 @@ func (pw *progressWriter) Write(p []byte) (int, error) {
 		pw.manager.repo.UpdateDownloadProgress(pw.download.ID, progress, pw.written)
 		pw.manager.Broadcast(pw.download)
 	}
-
-	return n, err
 }
 
 func (m *Manager) setError(download *models.Download, msg string) {
 	log.Printf("Download error for %s: %s", download.Name, msg)
+	from := download.Status
 	download.Status = models.StatusError
 	download.ErrorMessage = msg
-	m.repo.UpdateDownload(download)
-	m.Broadcast(download)
+	m.transition(download, from)
 }
 
 func isVideoFile(path string) bool {
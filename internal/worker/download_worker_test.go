@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/storage"
+)
+
+// testManager has what a file transfer needs: a database for progress and
+// a channel for broadcasts
+func testManager(t *testing.T, connections int) *Manager {
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Manager{
+		repo:        storage.NewRepository(db),
+		connections: connections,
+		updates:     make(chan Event, 16),
+	}
+}
+
+func TestDownloadFileDiscardsStatelessFullPart(t *testing.T) {
+	content := bytes.Repeat([]byte("movie data "), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "movie.mkv", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	// What a crash right after preallocating used to leave behind
+	dest := filepath.Join(t.TempDir(), "Movie.mkv")
+	if err := os.WriteFile(dest+partSuffix, make([]byte, len(content)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := testManager(t, 1)
+	link := &models.UnrestrictedLink{Download: server.URL, Filesize: int64(len(content))}
+	if err := m.downloadFile(context.Background(), &models.Download{}, link, dest, 0, 1); err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("the zero-filled .part was kept as the finished file")
+	}
+}
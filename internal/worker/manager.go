@@ -2,31 +2,68 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ygncode/real-debrid-downloader/internal/config"
 	"github.com/ygncode/real-debrid-downloader/internal/models"
 	"github.com/ygncode/real-debrid-downloader/internal/realdebrid"
 	"github.com/ygncode/real-debrid-downloader/internal/services"
 	"github.com/ygncode/real-debrid-downloader/internal/storage"
 )
 
+const (
+	// leaseDuration is how long a claimed job stays with a worker without
+	// a heartbeat before other workers may reclaim it
+	leaseDuration     = time.Minute
+	heartbeatInterval = 20 * time.Second
+
+	// queuePollInterval is how often idle workers check the queue
+	queuePollInterval = 2 * time.Second
+)
+
 type Manager struct {
 	downloadService *services.DownloadService
 	rdClient        *realdebrid.Client
 	repo            *storage.Repository
-	moviesPath      string
+	libraries       *services.Libraries // Library roots that downloads are written to
+	catalog         *services.CatalogService
 	subtitleService *services.SubtitleService
+	organizer       *services.OrganizerService
+	autoOrganize    bool // Organize downloads as they finish
+	connections     int  // Parallel connections per file download
+	retryMax        int  // Automatic retries for transient failures
+	retryBaseDelay  time.Duration
+	onCollision     string                // What to do when a file already exists
+	selection       models.SelectionRules // Default rules for picking torrent files
+	subLanguages    []string              // Default subtitle languages
+
+	wake    chan struct{} // Signals idle workers that a job was queued
+	pollNow chan struct{} // Asks the poller to check Real-Debrid right away
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
 
-	jobs      chan *models.Download
-	ctx       context.Context
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
-	maxWorkers int
+	// Worker pool size, adjustable at runtime
+	maxWorkers   int
+	running      int // Worker goroutines currently alive
+	nextWorkerID int
+	workersMu    sync.Mutex
+
+	// How often the poller checks Real-Debrid, adjustable at runtime
+	pollInterval atomic.Int64
+
+	// Downloads currently being processed by a worker
+	active   map[uint]*activeJob
+	activeMu sync.Mutex
 
 	// SSE broadcast channel
-	updates     chan *models.Download
-	subscribers map[chan *models.Download]bool
+	updates     chan Event
+	subscribers map[chan Event]bool
 	subMutex    sync.RWMutex
 }
 
@@ -34,32 +71,54 @@ func NewManager(
 	downloadService *services.DownloadService,
 	rdClient *realdebrid.Client,
 	repo *storage.Repository,
-	moviesPath string,
 	subtitleService *services.SubtitleService,
+	organizer *services.OrganizerService,
+	libraries *services.Libraries,
+	catalog *services.CatalogService,
+	cfg *config.Config,
 ) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Manager{
+	m := &Manager{
 		downloadService: downloadService,
 		rdClient:        rdClient,
 		repo:            repo,
-		moviesPath:      moviesPath,
+		libraries:       libraries,
+		catalog:         catalog,
 		subtitleService: subtitleService,
-		jobs:            make(chan *models.Download, 100),
+		organizer:       organizer,
+		autoOrganize:    cfg.Organize,
+		connections:     cfg.Connections,
+		retryMax:        cfg.RetryMax,
+		retryBaseDelay:  time.Duration(max(cfg.RetryDelay, 1)) * time.Second,
+		onCollision:     cfg.OnCollision,
+		selection:       cfg.Selection,
+		subLanguages:    cfg.SubtitleLanguages,
+		wake:            make(chan struct{}, 1),
+		pollNow:         make(chan struct{}, 1),
 		ctx:             ctx,
 		cancel:          cancel,
-		maxWorkers:      2,
-		updates:         make(chan *models.Download, 100),
-		subscribers:     make(map[chan *models.Download]bool),
+		maxWorkers:      max(cfg.MaxConcurrent, 1),
+		active:          make(map[uint]*activeJob),
+		updates:         make(chan Event, 100),
+		subscribers:     make(map[chan Event]bool),
 	}
+	m.pollInterval.Store(int64(time.Duration(max(cfg.PollInterval, 1)) * time.Second))
+
+	return m
 }
 
 func (m *Manager) Start() {
 	// Start worker goroutines
-	for i := 0; i < m.maxWorkers; i++ {
-		m.wg.Add(1)
-		go m.worker(i)
+	m.workersMu.Lock()
+	for m.running < m.maxWorkers {
+		m.spawnWorker()
 	}
+	m.workersMu.Unlock()
+
+	// Start the Real-Debrid status poller
+	m.wg.Add(1)
+	go m.poller()
 
 	// Start broadcast goroutine
 	go m.broadcaster()
@@ -70,7 +129,6 @@ func (m *Manager) Start() {
 func (m *Manager) Stop() {
 	log.Println("Stopping worker manager...")
 	m.cancel()
-	close(m.jobs)
 	m.wg.Wait()
 	close(m.updates)
 	log.Println("Worker manager stopped")
@@ -80,18 +138,85 @@ func (m *Manager) worker(id int) {
 	defer m.wg.Done()
 	log.Printf("Worker %d started", id)
 
+	owner := workerOwner(id)
+
 	for {
-		select {
-		case <-m.ctx.Done():
+		if m.ctx.Err() != nil {
 			log.Printf("Worker %d shutting down", id)
 			return
-		case download, ok := <-m.jobs:
-			if !ok {
+		}
+
+		// Only retire between jobs so in-flight work always finishes
+		if m.retire() {
+			log.Printf("Worker %d stopped, pool shrunk", id)
+			return
+		}
+
+		job, err := m.repo.ClaimJob(owner, leaseDuration)
+		if err != nil {
+			log.Printf("Worker %d: failed to claim job: %v", id, err)
+		}
+		if job == nil {
+			select {
+			case <-m.ctx.Done():
+				log.Printf("Worker %d shutting down", id)
+				return
+			case <-m.wake:
+			case <-time.After(queuePollInterval):
+			}
+			continue
+		}
+
+		m.runJob(owner, job)
+	}
+}
+
+// runJob processes a claimed job, keeping its lease alive until done
+func (m *Manager) runJob(owner string, job *models.Job) {
+	// The download may have been paused or removed while queued
+	download, err := m.repo.GetDownload(job.DownloadID)
+	if err != nil {
+		log.Printf("Dropping job for download %d: %v", job.DownloadID, err)
+		m.repo.CompleteJob(job.ID)
+		return
+	}
+	if download.Status == models.StatusPaused || download.Status == models.StatusCancelled {
+		log.Printf("Skipping %s download: %s", download.Status, download.Name)
+		m.repo.CompleteJob(job.ID)
+		return
+	}
+
+	stopHeartbeat := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
 				return
+			case <-ticker.C:
+				if err := m.repo.HeartbeatJob(job.ID, owner, leaseDuration); err != nil {
+					log.Printf("Failed to renew lease for download %d: %v", job.DownloadID, err)
+				}
 			}
-			m.processDownload(download)
 		}
+	}()
+
+	m.processDownload(download)
+	close(stopHeartbeat)
+
+	// Hand unfinished work back to the queue when shutting down
+	if m.ctx.Err() != nil {
+		m.repo.ReleaseJob(job.ID, owner)
+		return
 	}
+	m.repo.CompleteJob(job.ID)
+}
+
+// workerOwner identifies a worker in job leases
+func workerOwner(id int) string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%d", host, os.Getpid(), id)
 }
 
 func (m *Manager) broadcaster() {
@@ -108,9 +233,16 @@ func (m *Manager) broadcaster() {
 	}
 }
 
-// Subscribe returns a channel for receiving download updates
-func (m *Manager) Subscribe() chan *models.Download {
-	ch := make(chan *models.Download, 10)
+// Event is an update for subscribers: a download that changed, or a
+// change to the collection that no download caused
+type Event struct {
+	Download      *models.Download
+	RefreshMovies bool
+}
+
+// Subscribe returns a channel for receiving updates
+func (m *Manager) Subscribe() chan Event {
+	ch := make(chan Event, 10)
 	m.subMutex.Lock()
 	m.subscribers[ch] = true
 	m.subMutex.Unlock()
@@ -118,7 +250,7 @@ func (m *Manager) Subscribe() chan *models.Download {
 }
 
 // Unsubscribe removes a subscriber
-func (m *Manager) Unsubscribe(ch chan *models.Download) {
+func (m *Manager) Unsubscribe(ch chan Event) {
 	m.subMutex.Lock()
 	delete(m.subscribers, ch)
 	m.subMutex.Unlock()
@@ -127,24 +259,52 @@ func (m *Manager) Unsubscribe(ch chan *models.Download) {
 
 // Broadcast sends an update to all subscribers
 func (m *Manager) Broadcast(download *models.Download) {
+	m.send(Event{Download: download})
+}
+
+// RefreshMovies tells subscribers the collection changed, after files were
+// renamed, moved or deleted from the web UI or API
+func (m *Manager) RefreshMovies() {
+	m.send(Event{RefreshMovies: true})
+}
+
+func (m *Manager) send(event Event) {
 	select {
-	case m.updates <- download:
+	case m.updates <- event:
 	default:
 		// Skip if updates channel is full
 	}
 }
 
-// QueueDownload adds a download to the processing queue
+// QueueDownload hands a download to whoever works on its current phase.
+// Downloads still waiting on Real-Debrid go to the poller, everything
+// else gets a job in the persistent queue.
 func (m *Manager) QueueDownload(download *models.Download) {
+	if download.Status == models.StatusPending || download.Status == models.StatusProcessing {
+		select {
+		case m.pollNow <- struct{}{}:
+		default:
+			// A poll is already pending
+		}
+		return
+	}
+
+	if err := m.repo.EnqueueJob(download.ID); err != nil {
+		log.Printf("Failed to queue download %s: %v", download.Name, err)
+		return
+	}
+	log.Printf("Queued download: %s", download.Name)
+
 	select {
-	case m.jobs <- download:
-		log.Printf("Queued download: %s", download.Name)
+	case m.wake <- struct{}{}:
 	default:
-		log.Printf("Warning: job queue full, could not queue download: %s", download.Name)
+		// A wake-up is already pending
 	}
 }
 
-// ResumePendingDownloads queues any pending downloads from the database
+// ResumePendingDownloads makes sure every unfinished download has a job.
+// Jobs that were running when the process died are reclaimed once their
+// lease expires.
 func (m *Manager) ResumePendingDownloads() {
 	downloads, err := m.repo.GetPendingDownloads()
 	if err != nil {
@@ -153,7 +313,7 @@ func (m *Manager) ResumePendingDownloads() {
 	}
 
 	for _, download := range downloads {
-		d := download // Create a copy for the goroutine
+		d := download
 		m.QueueDownload(&d)
 	}
 
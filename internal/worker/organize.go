@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/services"
+)
+
+// PreviewOrganize returns the moves Organize would make, without moving
+// anything
+func (m *Manager) PreviewOrganize(id uint) ([]services.Move, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if !canOrganize(download.Status) {
+		return nil, fmt.Errorf("download cannot be organized while %s", download.Status)
+	}
+	library, err := m.libraries.Root(download.Library)
+	if err != nil {
+		return nil, err
+	}
+	return m.organizer.Plan(library, download)
+}
+
+// Organize moves the files of a finished download into the library layout
+// and records their new paths
+func (m *Manager) Organize(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if !canOrganize(download.Status) {
+		return nil, fmt.Errorf("download cannot be organized while %s", download.Status)
+	}
+
+	err = m.organize(download)
+	m.refreshCatalog(download)
+	if updateErr := m.repo.UpdateDownload(download); updateErr != nil {
+		return nil, fmt.Errorf("failed to update download: %w", updateErr)
+	}
+	m.Broadcast(download)
+	if err != nil {
+		return nil, err
+	}
+
+	return download, nil
+}
+
+// organize applies the organizer's plan to a download. The caller saves it,
+// even on error, since files moved before the error are recorded.
+func (m *Manager) organize(download *models.Download) error {
+	library, err := m.libraries.Root(download.Library)
+	if err != nil {
+		return err
+	}
+	moves, err := m.organizer.Plan(library, download)
+	if err != nil {
+		return fmt.Errorf("failed to plan moves: %w", err)
+	}
+
+	return m.organizer.Apply(library, download, moves)
+}
+
+// refreshCatalog updates the library catalog for the torrent folder of a
+// download and wherever its files ended up
+func (m *Manager) refreshCatalog(download *models.Download) {
+	var paths []string
+	if folder, err := m.torrentFolder(download); err == nil {
+		paths = append(paths, folder)
+	}
+	if download.FilePaths != "" {
+		var filePaths []string
+		json.Unmarshal([]byte(download.FilePaths), &filePaths)
+		paths = append(paths, filePaths...)
+	}
+	m.catalog.Refresh(download.Library, paths...)
+}
+
+func canOrganize(status models.DownloadStatus) bool {
+	return status == models.StatusComplete || status == models.StatusPartial
+}
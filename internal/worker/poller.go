@@ -0,0 +1,296 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+const (
+	// How long a download may wait on Real-Debrid in each phase
+	filesReadyTimeout = 30 * time.Minute
+	downloadedTimeout = 24 * time.Hour
+)
+
+// poller checks every download that is waiting on Real-Debrid in one
+// batch and moves it through its states. Workers are only handed a job
+// once there are files to transfer. It also restarts failed downloads
+// whose automatic retry is due.
+func (m *Manager) poller() {
+	defer m.wg.Done()
+
+	interval := m.PollInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Remembers when each download entered its current remote phase
+	since := make(map[uint]phaseStart)
+
+	for {
+		m.retryDue()
+		m.pollRemote(since)
+
+		if current := m.PollInterval(); current != interval {
+			interval = current
+			ticker.Reset(interval)
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.pollNow:
+		}
+	}
+}
+
+type phaseStart struct {
+	status models.DownloadStatus
+	at     time.Time
+}
+
+// pollRemote fetches the account's torrents once and advances every
+// download that is waiting on Real-Debrid
+func (m *Manager) pollRemote(since map[uint]phaseStart) {
+	downloads, err := m.repo.GetRemoteDownloads()
+	if err != nil {
+		log.Printf("Error getting remote downloads: %v", err)
+		return
+	}
+
+	if len(downloads) == 0 {
+		clear(since)
+		return
+	}
+
+	torrents, err := m.rdClient.GetTorrents(m.ctx)
+	if err != nil {
+		log.Printf("Error getting torrents: %v", err)
+		return
+	}
+
+	byID := make(map[string]*models.TorrentInfo, len(torrents))
+	for i := range torrents {
+		byID[torrents[i].ID] = &torrents[i]
+	}
+
+	seen := make(map[uint]bool, len(downloads))
+	for i := range downloads {
+		download := &downloads[i]
+		seen[download.ID] = true
+
+		start, ok := since[download.ID]
+		if !ok || start.status != download.Status {
+			start = phaseStart{status: download.Status, at: time.Now()}
+			since[download.ID] = start
+		}
+
+		info := byID[download.TorrentID]
+		if info == nil {
+			// Older torrents may fall outside the listed page
+			if info, err = m.rdClient.GetTorrentInfo(m.ctx, download.TorrentID); err != nil {
+				log.Printf("Error getting torrent info: %v", err)
+				continue
+			}
+		}
+
+		switch download.Status {
+		case models.StatusPending:
+			m.advancePending(download, info, time.Since(start.at))
+		case models.StatusProcessing:
+			m.advanceProcessing(download, info, time.Since(start.at))
+		}
+	}
+
+	for id := range since {
+		if !seen[id] {
+			delete(since, id)
+		}
+	}
+}
+
+// advancePending waits for Real-Debrid to list the torrent's files
+func (m *Manager) advancePending(download *models.Download, info *models.TorrentInfo, waited time.Duration) {
+	// Update name if we got it from the API
+	if info.Filename != "" && download.Name == "Processing..." {
+		download.Name = info.Filename
+		m.transition(download, models.StatusPending)
+	}
+
+	switch info.Status {
+	case models.RDStatusWaitingFilesSelection:
+		// The torrent list does not include files
+		full, err := m.rdClient.GetTorrentInfo(m.ctx, download.TorrentID)
+		if err != nil {
+			log.Printf("Error getting torrent info: %v", err)
+			return
+		}
+
+		filesJSON, _ := json.Marshal(full.Files)
+		download.FilesJSON = string(filesJSON)
+		download.TotalSize = full.Bytes
+
+		// A re-added torrent already knows which files to fetch
+		if download.SelectedIDs != "" {
+			m.applySelection(download, models.StatusPending)
+			return
+		}
+
+		if ids := m.selectionRules(download).Match(full.Files); len(ids) > 0 {
+			download.SelectedIDs = joinIDs(ids)
+			log.Printf("Selection rules picked %d of %d files for %s", len(ids), len(full.Files), download.Name)
+			m.applySelection(download, models.StatusPending)
+			return
+		}
+
+		download.Status = models.StatusAwaitingSelection
+		if m.transition(download, models.StatusPending) {
+			log.Printf("Torrent %s ready for file selection", download.Name)
+		}
+
+	case models.RDStatusMagnetError, models.RDStatusError, models.RDStatusVirus, models.RDStatusDead:
+		m.remoteError(download, models.StatusPending, fmt.Sprintf("Torrent error: %s", info.Status))
+
+	case models.RDStatusMagnetConversion:
+		log.Printf("Torrent %s: converting magnet...", download.Name)
+		if waited > filesReadyTimeout {
+			m.remoteTimeout(download, models.StatusPending, "Timeout waiting for torrent to be ready")
+		}
+
+	default:
+		if waited > filesReadyTimeout {
+			m.remoteTimeout(download, models.StatusPending, "Timeout waiting for torrent to be ready")
+		}
+	}
+}
+
+// advanceProcessing follows Real-Debrid's own download and queues the
+// file transfer once it is done
+func (m *Manager) advanceProcessing(download *models.Download, info *models.TorrentInfo, waited time.Duration) {
+	switch info.Status {
+	case models.RDStatusDownloaded:
+		links := info.Links
+		if len(links) == 0 {
+			full, err := m.rdClient.GetTorrentInfo(m.ctx, download.TorrentID)
+			if err != nil {
+				log.Printf("Error getting torrent info: %v", err)
+				return
+			}
+			links = full.Links
+		}
+
+		// Torrent is ready, store links and queue the file download
+		linksJSON, _ := json.Marshal(links)
+		download.Links = string(linksJSON)
+		download.Status = models.StatusDownloading
+		download.Progress = 0 // Reset progress for file download phase
+		if m.transition(download, models.StatusProcessing) {
+			log.Printf("Torrent %s downloaded on Real-Debrid, queueing file download", download.Name)
+			m.QueueDownload(download)
+		}
+		return
+
+	case models.RDStatusMagnetError, models.RDStatusError, models.RDStatusVirus, models.RDStatusDead:
+		m.remoteError(download, models.StatusProcessing, fmt.Sprintf("Torrent error: %s", info.Status))
+		return
+
+	case models.RDStatusWaitingFilesSelection:
+		// Resumed before the selection reached a re-added torrent
+		m.applySelection(download, models.StatusProcessing)
+		return
+
+	case models.RDStatusQueued:
+		log.Printf("Torrent %s: queued on Real-Debrid", download.Name)
+
+	case models.RDStatusDownloading:
+		log.Printf("Torrent %s: downloading %.1f%%", download.Name, info.Progress)
+	}
+
+	if waited > downloadedTimeout {
+		m.remoteTimeout(download, models.StatusProcessing, "Timeout waiting for torrent download")
+		return
+	}
+
+	// Update progress
+	if info.Progress != download.Progress {
+		download.Progress = info.Progress
+		m.transition(download, models.StatusProcessing)
+	}
+}
+
+// applySelection selects the download's chosen files on Real-Debrid and
+// moves it on to wait for the torrent to download. Failures are retried
+// on the next poll.
+func (m *Manager) applySelection(download *models.Download, from models.DownloadStatus) {
+	if err := m.rdClient.SelectFiles(m.ctx, download.TorrentID, download.SelectedIDs); err != nil {
+		log.Printf("Failed to select files for %s: %v", download.Name, err)
+		return
+	}
+
+	download.Status = models.StatusProcessing
+	if m.transition(download, from) {
+		log.Printf("Selected files %s for %s", download.SelectedIDs, download.Name)
+	}
+}
+
+// selectionRules returns the rules that pick a download's files, falling
+// back to the defaults unless the download was added with its own
+func (m *Manager) selectionRules(download *models.Download) models.SelectionRules {
+	if download.SelectionRules == "" {
+		return m.selection
+	}
+
+	var rules models.SelectionRules
+	if err := json.Unmarshal([]byte(download.SelectionRules), &rules); err != nil {
+		log.Printf("Ignoring bad selection rules for %s: %v", download.Name, err)
+		return m.selection
+	}
+	return rules
+}
+
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// transition saves a download the poller or a worker changed, unless it was
+// paused or cancelled in the meantime, and broadcasts the update
+func (m *Manager) transition(download *models.Download, from models.DownloadStatus) bool {
+	download.UpdatedAt = time.Now()
+
+	ok, err := m.repo.UpdateDownloadIfStatus(download, from)
+	if err != nil {
+		log.Printf("Failed to update download %s: %v", download.Name, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	m.Broadcast(download)
+	return true
+}
+
+// remoteError marks a download failed by Real-Debrid
+func (m *Manager) remoteError(download *models.Download, from models.DownloadStatus, msg string) {
+	log.Printf("Download error for %s: %s", download.Name, msg)
+	download.Status = models.StatusError
+	download.ErrorMessage = msg
+	m.transition(download, from)
+}
+
+// remoteTimeout marks a download failed after waiting too long on
+// Real-Debrid and schedules an automatic retry. Torrent errors such as
+// virus or magnet_error are final and go through remoteError alone.
+func (m *Manager) remoteTimeout(download *models.Download, from models.DownloadStatus, msg string) {
+	m.scheduleRetry(download)
+	m.remoteError(download, from, msg)
+}
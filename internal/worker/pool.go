@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// PoolStats describes the worker pool and poller settings
+type PoolStats struct {
+	MaxWorkers   int `json:"max_workers"`
+	Running      int `json:"running"`       // Worker goroutines alive, including ones about to retire
+	Busy         int `json:"busy"`          // Workers currently processing a download
+	PollInterval int `json:"poll_interval"` // Seconds between Real-Debrid status checks
+}
+
+// spawnWorker starts one more worker goroutine. Callers must hold workersMu.
+func (m *Manager) spawnWorker() {
+	id := m.nextWorkerID
+	m.nextWorkerID++
+	m.running++
+
+	m.wg.Add(1)
+	go m.worker(id)
+}
+
+// retire reports whether the calling worker should exit because the pool
+// is larger than asked for, and if so removes it from the count
+func (m *Manager) retire() bool {
+	m.workersMu.Lock()
+	defer m.workersMu.Unlock()
+
+	if m.running > m.maxWorkers {
+		m.running--
+		return true
+	}
+	return false
+}
+
+// SetMaxWorkers grows or shrinks the worker pool. New workers start right
+// away; surplus workers exit once they finish their current job.
+func (m *Manager) SetMaxWorkers(n int) error {
+	if n < 1 {
+		return fmt.Errorf("max workers must be at least 1")
+	}
+
+	m.workersMu.Lock()
+	m.maxWorkers = n
+	for m.running < n {
+		m.spawnWorker()
+	}
+	m.workersMu.Unlock()
+
+	log.Printf("Worker pool resized to %d", n)
+	return nil
+}
+
+// SetPollInterval changes how often Real-Debrid is polled
+func (m *Manager) SetPollInterval(interval time.Duration) error {
+	if interval < time.Second {
+		return fmt.Errorf("poll interval must be at least 1 second")
+	}
+
+	m.pollInterval.Store(int64(interval))
+
+	// Wake the poller so the new interval takes effect now
+	select {
+	case m.pollNow <- struct{}{}:
+	default:
+	}
+
+	log.Printf("Poll interval set to %s", interval)
+	return nil
+}
+
+// PollInterval returns how often Real-Debrid is polled
+func (m *Manager) PollInterval() time.Duration {
+	return time.Duration(m.pollInterval.Load())
+}
+
+// Stats returns the current worker pool settings and usage
+func (m *Manager) Stats() PoolStats {
+	m.workersMu.Lock()
+	stats := PoolStats{
+		MaxWorkers: m.maxWorkers,
+		Running:    m.running,
+	}
+	m.workersMu.Unlock()
+
+	m.activeMu.Lock()
+	stats.Busy = len(m.active)
+	m.activeMu.Unlock()
+
+	stats.PollInterval = int(m.PollInterval() / time.Second)
+	return stats
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+	"github.com/ygncode/real-debrid-downloader/internal/realdebrid"
+)
+
+// maxRetryDelay caps the exponential backoff between automatic retries
+const maxRetryDelay = time.Hour
+
+// retryDelay returns how long to wait before the given automatic retry,
+// doubling from the base delay each time
+func (m *Manager) retryDelay(attempt int) time.Duration {
+	delay := m.retryBaseDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// scheduleRetry books an automatic retry for a failed download if it has
+// any left. The caller saves the download.
+func (m *Manager) scheduleRetry(download *models.Download) bool {
+	if download.RetryCount >= m.retryMax {
+		download.NextRetryAt = nil
+		return false
+	}
+
+	download.RetryCount++
+	next := time.Now().UTC().Add(m.retryDelay(download.RetryCount))
+	download.NextRetryAt = &next
+	log.Printf("Retrying %s automatically at %s (attempt %d/%d)",
+		download.Name, next.Local().Format(time.Kitchen), download.RetryCount, m.retryMax)
+	return true
+}
+
+// Retry puts a failed download back into the phase it failed in. Files
+// that already finished are kept.
+func (m *Manager) Retry(id uint) (*models.Download, error) {
+	download, err := m.repo.GetDownload(id)
+	if err != nil {
+		return nil, fmt.Errorf("download not found: %w", err)
+	}
+	if download.Status != models.StatusError && download.Status != models.StatusPartial {
+		return nil, fmt.Errorf("download has not failed")
+	}
+
+	// A manual retry starts a fresh round of automatic ones
+	download.RetryCount = 0
+	if !m.reenter(download) {
+		return nil, fmt.Errorf("download changed while retrying")
+	}
+	log.Printf("Retrying download: %s", download.Name)
+
+	return download, nil
+}
+
+// retryDue re-enters every failed download whose automatic retry is due
+func (m *Manager) retryDue() {
+	downloads, err := m.repo.GetDueRetries(time.Now().UTC())
+	if err != nil {
+		log.Printf("Error getting due retries: %v", err)
+		return
+	}
+
+	for i := range downloads {
+		download := &downloads[i]
+		if m.reenter(download) {
+			log.Printf("Automatic retry %d/%d of %s", download.RetryCount, m.retryMax, download.Name)
+		}
+	}
+}
+
+// reenter moves a failed download back to the phase it got to and hands
+// it to the poller or the queue
+func (m *Manager) reenter(download *models.Download) bool {
+	from := download.Status
+
+	download.Status = resumeStatus(download)
+	download.ErrorMessage = ""
+	download.NextRetryAt = nil
+	if !m.transition(download, from) {
+		return false
+	}
+
+	m.QueueDownload(download)
+	return true
+}
+
+// isTransient reports whether an error is likely to go away on its own,
+// such as a timeout, a dropped connection or a server error. Anything
+// else needs someone to look at it before retrying makes sense.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return isTransientStatus(se.code)
+	}
+
+	var ae *realdebrid.APIError
+	if errors.As(err, &ae) {
+		return isTransientStatus(ae.StatusCode)
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	// Failures to reach the host at all
+	var oe *net.OpError
+	return errors.As(err, &oe)
+}
+
+func isTransientStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
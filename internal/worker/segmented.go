@@ -0,0 +1,337 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ygncode/real-debrid-downloader/internal/models"
+)
+
+const (
+	// stateSuffix is appended to a .part file to hold segment progress
+	stateSuffix = ".state"
+
+	// minSegmentSize keeps small files from being split into many tiny requests
+	minSegmentSize = 8 << 20
+)
+
+// errRangesUnsupported is returned when the host ignores Range requests
+var errRangesUnsupported = errors.New("host does not support range requests")
+
+// segment is a byte range of a file fetched over its own connection
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`  // Inclusive
+	Done  int64 `json:"done"` // Bytes written from Start
+}
+
+func (s *segment) remaining() int64 {
+	return s.End - s.Start + 1 - s.Done
+}
+
+// segmentState is persisted next to the .part file so a segmented
+// transfer can resume each range where it stopped
+type segmentState struct {
+	Size     int64      `json:"size"`
+	Segments []*segment `json:"segments"`
+}
+
+// segmentedTransfer downloads the segments of one file in parallel into
+// a preallocated .part file
+type segmentedTransfer struct {
+	url       string
+	out       *os.File
+	statePath string
+	state     *segmentState
+	pw        *progressWriter
+	mu        sync.Mutex // Guards segment progress
+}
+
+// segmentCount returns how many connections to use for a link, honoring
+// the chunk limit Real-Debrid reports for the host
+func (m *Manager) segmentCount(link *models.UnrestrictedLink) int {
+	n := m.connections
+	if link.Chunks > 0 && link.Chunks < n {
+		n = link.Chunks
+	}
+	if maxBySize := int(link.Filesize / minSegmentSize); maxBySize < n {
+		n = maxBySize
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// downloadSegmented fetches link into partPath using n parallel range
+// requests, resuming from saved segment state when there is one
+func (m *Manager) downloadSegmented(ctx context.Context, download *models.Download, link *models.UnrestrictedLink, partPath string, n, linkIndex, totalLinks int) error {
+	statePath := partPath + stateSuffix
+
+	state, err := loadSegmentState(statePath)
+	if err != nil || state.Size != link.Filesize {
+		if n < 2 {
+			// Saved state is unusable and a single connection was asked for
+			return errRangesUnsupported
+		}
+		state = newSegmentState(link.Filesize, n)
+	}
+
+	out, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer out.Close()
+
+	var done int64
+	for _, seg := range state.Segments {
+		done += seg.Done
+	}
+	download.Downloaded = done
+
+	t := &segmentedTransfer{
+		url:       link.Download,
+		out:       out,
+		statePath: statePath,
+		state:     state,
+		pw: &progressWriter{
+			total:      state.Size,
+			written:    done,
+			download:   download,
+			manager:    m,
+			linkIndex:  linkIndex,
+			totalLinks: totalLinks,
+			lastUpdate: time.Now(),
+		},
+	}
+
+	// The state goes to disk before the file is grown, so a full size
+	// .part is never left without the record of which bytes are real
+	if err := t.save(); err != nil {
+		return err
+	}
+	// Preallocate so every segment can write at its own offset
+	if err := out.Truncate(state.Size); err != nil {
+		return fmt.Errorf("failed to allocate file: %w", err)
+	}
+
+	if done > 0 {
+		log.Printf("Resuming %s at %d of %d bytes over %d connections", filepath.Base(partPath), done, state.Size, len(state.Segments))
+	}
+
+	if err := t.run(ctx); err != nil {
+		if !errors.Is(err, errRangesUnsupported) {
+			t.save()
+		}
+		return err
+	}
+
+	os.Remove(statePath)
+	return nil
+}
+
+// run downloads all unfinished segments, retrying each one independently
+func (t *segmentedTransfer) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(t.state.Segments))
+
+	for i, seg := range t.state.Segments {
+		if seg.remaining() <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, seg *segment) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("%s (segment %d)", filepath.Base(t.out.Name()), i+1)
+			if err := retryTransfer(ctx, name, func() error { return t.fetch(ctx, seg) }); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(i, seg)
+	}
+
+	// Persist segment progress while the transfer runs
+	stopSaving := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopSaving:
+				return
+			case <-ticker.C:
+				t.save()
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stopSaving)
+	close(errs)
+
+	// Prefer the error that stopped the transfer over the cancellations it caused
+	var firstErr error
+	for err := range errs {
+		if firstErr == nil || errors.Is(firstErr, context.Canceled) {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// fetch downloads the rest of one segment
+func (t *segmentedTransfer) fetch(ctx context.Context, seg *segment) error {
+	t.mu.Lock()
+	from := seg.Start + seg.Done
+	t.mu.Unlock()
+
+	if from > seg.End {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, seg.End))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to start download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != from {
+			return errRangesUnsupported
+		}
+	case http.StatusOK:
+		return errRangesUnsupported
+	default:
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	_, err = io.Copy(&segmentWriter{t: t, seg: seg}, resp.Body)
+
+	t.mu.Lock()
+	remaining := seg.remaining()
+	t.mu.Unlock()
+	if remaining == 0 {
+		return nil
+	}
+
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("download failed: %w", err)
+}
+
+// save writes the current segment progress to disk
+func (t *segmentedTransfer) save() error {
+	t.mu.Lock()
+	data, err := json.Marshal(t.state)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(t.statePath, data, 0644); err != nil {
+		log.Printf("Failed to save segment state %s: %v", t.statePath, err)
+		return fmt.Errorf("failed to save segment state: %w", err)
+	}
+	return nil
+}
+
+// segmentWriter writes a response body into its segment of the file
+type segmentWriter struct {
+	t   *segmentedTransfer
+	seg *segment
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	w.t.mu.Lock()
+	offset := w.seg.Start + w.seg.Done
+	remaining := w.seg.remaining()
+	w.t.mu.Unlock()
+
+	// Never write into the next segment, even if the host sends too much
+	short := false
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+		short = true
+	}
+
+	n, err := w.t.out.WriteAt(p, offset)
+
+	w.t.mu.Lock()
+	w.seg.Done += int64(n)
+	w.t.mu.Unlock()
+	w.t.pw.add(int64(n))
+
+	if err == nil && short {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// newSegmentState splits size bytes into n ranges of near equal length
+func newSegmentState(size int64, n int) *segmentState {
+	state := &segmentState{Size: size}
+	chunk := size / int64(n)
+
+	var start int64
+	for i := 0; i < n; i++ {
+		end := start + chunk - 1
+		if i == n-1 {
+			end = size - 1
+		}
+		state.Segments = append(state.Segments, &segment{Start: start, End: end})
+		start = end + 1
+	}
+	return state
+}
+
+func loadSegmentState(path string) (*segmentState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state segmentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// hasSegmentState reports whether a .part file was written by a segmented transfer
+func hasSegmentState(partPath string) bool {
+	_, err := os.Stat(partPath + stateSuffix)
+	return err == nil
+}
+
+// discardPart removes a partial file and its segment state
+func discardPart(partPath string) error {
+	if err := os.Remove(partPath + stateSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove segment state: %w", err)
+	}
+	if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove partial file: %w", err)
+	}
+	return nil
+}
@@ -48,12 +48,38 @@ function switchTab(tabName) {
 }
 
 // Form Submissions
+// Selection presets offered in the add dialog. "default" leaves the
+// server's rules in charge.
+const selectionPresets = {
+    largest: {
+        extensions: ['.mkv', '.mp4', '.avi', '.m4v', '.srt', '.ass', '.ssa', '.sub', '.vtt'],
+        exclude: ['\\bextras?\\b', 'featurettes?'],
+        exclude_samples: true,
+        largest_only: true
+    },
+    all: { all: true },
+    manual: { manual: true }
+};
+
+// subtitleLanguages reads a comma separated list of language codes, or
+// returns an empty list to use the configured ones
+function subtitleLanguages(inputId) {
+    const value = document.getElementById(inputId)?.value || '';
+    return value.split(/[\s,]+/).filter(Boolean);
+}
+
+function selectionRules(selectId) {
+    const value = document.getElementById(selectId)?.value;
+    return selectionPresets[value] || null;
+}
+
 async function submitMagnet(event) {
     event.preventDefault();
     const form = event.target;
     const btn = form.querySelector('.btn-submit');
     const magnetInput = document.getElementById('magnet-input');
     const downloadSubs = document.getElementById('magnet-subs')?.checked ?? true;
+    const selection = selectionRules('magnet-selection');
 
     btn.classList.add('loading');
     btn.disabled = true;
@@ -62,7 +88,14 @@ async function submitMagnet(event) {
         const response = await fetch('/api/torrents/magnet', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ magnet: magnetInput.value, download_subs: downloadSubs })
+            body: JSON.stringify({
+                magnet: magnetInput.value,
+                download_subs: downloadSubs,
+                subtitle_languages: subtitleLanguages('magnet-languages'),
+                selection: selection,
+                library: document.getElementById('magnet-library')?.value || '',
+                tag: document.getElementById('magnet-tag')?.value.trim() || ''
+            })
         });
 
         const data = await response.json();
@@ -99,6 +132,14 @@ async function submitTorrentFile(event) {
     const formData = new FormData();
     formData.append('torrent', fileInput.files[0]);
     formData.append('download_subs', downloadSubs ? 'true' : 'false');
+    formData.append('subtitle_languages', subtitleLanguages('file-languages').join(','));
+
+    const selection = selectionRules('file-selection');
+    if (selection) {
+        formData.append('selection', JSON.stringify(selection));
+    }
+    formData.append('library', document.getElementById('file-library')?.value || '');
+    formData.append('tag', document.getElementById('file-tag')?.value.trim() || '');
 
     try {
         const response = await fetch('/api/torrents/file', {
@@ -187,6 +228,63 @@ async function deleteDownload(id) {
     }
 }
 
+async function controlDownload(id, action) {
+    if (action === 'cancel' && !confirm('Cancel this download? Partially downloaded files will be removed.')) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/downloads/${id}/${action}`, {
+            method: 'POST'
+        });
+
+        const data = await response.json();
+
+        if (!response.ok) {
+            throw new Error(data.error || `Failed to ${action} download`);
+        }
+
+        refreshDownloads();
+    } catch (error) {
+        alert('Error: ' + error.message);
+    }
+}
+
+async function moveDownload(id, to, position) {
+    try {
+        const response = await fetch(`/api/downloads/${id}/move`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ to: to, position: position || 0 })
+        });
+
+        const data = await response.json();
+
+        if (!response.ok) {
+            throw new Error(data.error || 'Failed to move download');
+        }
+
+        refreshDownloads();
+    } catch (error) {
+        alert('Error: ' + error.message);
+    }
+}
+
+function moveDownloadTo(id, current) {
+    const input = prompt('Move to queue position:', current);
+    if (input === null) {
+        return;
+    }
+
+    const position = parseInt(input, 10);
+    if (!position || position < 1) {
+        alert('Please enter a position of 1 or more');
+        return;
+    }
+
+    moveDownload(id, 'position', position);
+}
+
 // File Selection Helpers
 function toggleAllFiles(checkbox) {
     const fileCheckboxes = document.querySelectorAll('.file-checkbox');
@@ -213,9 +311,9 @@ function refreshDownloads() {
 }
 
 // Delete file from collection
-async function deleteFile(path) {
+async function deleteFile(library, path) {
     const fileName = path.split('/').pop();
-    if (!confirm(`Are you sure you want to delete "${fileName}"?\n\nThis action cannot be undone.`)) {
+    if (!confirm(`Move "${fileName}" to the trash?`)) {
         return;
     }
 
@@ -223,7 +321,7 @@ async function deleteFile(path) {
         const response = await fetch('/api/movies', {
             method: 'DELETE',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ path: path })
+            body: JSON.stringify({ library: library, path: path })
         });
 
         if (!response.ok) {
@@ -238,6 +336,114 @@ async function deleteFile(path) {
     }
 }
 
+// Rename, move and create folders in the collection
+async function fileAction(url, body, failure) {
+    try {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
+
+        const data = await response.json();
+
+        if (!response.ok) {
+            throw new Error(data.error || failure);
+        }
+
+        refreshMovies();
+    } catch (error) {
+        alert('Error: ' + error.message);
+    }
+}
+
+function renameFile(library, path, name) {
+    const newName = prompt('Rename to:', name);
+    if (newName === null || newName.trim() === '' || newName === name) {
+        return;
+    }
+    fileAction('/api/movies/rename', { library: library, path: path, name: newName.trim() }, 'Failed to rename');
+}
+
+function moveFile(library, path) {
+    const parts = path.split('/');
+    const current = parts.slice(0, -1).join('/');
+    const folder = prompt('Move into folder (empty for the top of the library, created if missing):', current);
+    if (folder === null || folder.trim() === current) {
+        return;
+    }
+    fileAction('/api/movies/move', { library: library, path: path, to: folder.trim() }, 'Failed to move');
+}
+
+function createFolder() {
+    const library = document.getElementById('library-filter')?.value || '';
+    const path = prompt(`New folder${library ? ' in ' + library : ''}:`);
+    if (path === null || path.trim() === '') {
+        return;
+    }
+    fileAction('/api/movies/folder', { library: library, path: path.trim() }, 'Failed to create folder');
+}
+
+// Trash
+function openTrash() {
+    document.getElementById('trash-modal').classList.add('active');
+    document.getElementById('trash-content').innerHTML = '<div class="empty-state"><div class="spinner"></div><p>Loading trash...</p></div>';
+    refreshTrash();
+}
+
+function closeTrashModal(event) {
+    if (event && event.target !== event.currentTarget) return;
+    document.getElementById('trash-modal').classList.remove('active');
+}
+
+function refreshTrash() {
+    const content = document.getElementById('trash-content');
+    const library = document.getElementById('library-filter')?.value;
+    const params = library ? '?library=' + encodeURIComponent(library) : '';
+
+    fetch('/api/trash' + params)
+        .then(response => response.text())
+        .then(html => {
+            content.innerHTML = html;
+        })
+        .catch(error => {
+            content.innerHTML = `<div class="error-state"><p>Error loading trash: ${error.message}</p></div>`;
+        });
+}
+
+async function trashAction(url, method) {
+    try {
+        const response = await fetch(url, { method: method });
+        if (!response.ok) {
+            const data = await response.json();
+            throw new Error(data.error || 'Trash action failed');
+        }
+        refreshTrash();
+        refreshMovies();
+    } catch (error) {
+        alert('Error: ' + error.message);
+    }
+}
+
+function restoreTrashItem(library, id) {
+    trashAction(`/api/trash/${id}/restore?library=${encodeURIComponent(library)}`, 'POST');
+}
+
+function purgeTrashItem(library, id, name) {
+    if (!confirm(`Delete "${name}" forever?\n\nThis action cannot be undone.`)) {
+        return;
+    }
+    trashAction(`/api/trash/${id}?library=${encodeURIComponent(library)}`, 'DELETE');
+}
+
+function emptyTrash() {
+    const library = document.getElementById('library-filter')?.value;
+    if (!confirm(`Delete everything in the trash${library ? ' of ' + library : ''} forever?\n\nThis action cannot be undone.`)) {
+        return;
+    }
+    trashAction('/api/trash' + (library ? '?library=' + encodeURIComponent(library) : ''), 'DELETE');
+}
+
 // SSE Event Handling
 document.addEventListener('DOMContentLoaded', function() {
     // File input change handler
@@ -271,6 +477,7 @@ document.addEventListener('DOMContentLoaded', function() {
         if (e.key === 'Escape') {
             closeAddModal();
             closeFileSelectModal();
+            closeTrashModal();
         }
     });
 
@@ -310,9 +517,24 @@ function setupSSE() {
     };
 }
 
+// Search the collection once typing pauses
+let searchTimer = null;
+function searchMovies() {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(refreshMovies, 300);
+}
+
 // Refresh movies list
 function refreshMovies() {
-    fetch('/api/movies')
+    const params = new URLSearchParams();
+    const library = document.getElementById('library-filter')?.value;
+    const search = document.getElementById('movie-search')?.value.trim();
+    const sort = document.getElementById('movie-sort')?.value;
+    if (library) params.set('library', library);
+    if (search) params.set('q', search);
+    if (sort) params.set('sort', sort);
+
+    fetch('/api/movies?' + params.toString())
         .then(response => response.text())
         .then(html => {
             document.getElementById('movies-list').innerHTML = html;
@@ -354,7 +576,10 @@ function updateDownloadItem(download) {
         if (download.status === 'awaiting_selection' ||
             download.status === 'subtitles' ||
             download.status === 'complete' ||
-            download.status === 'error') {
+            download.status === 'error' ||
+            download.status === 'partial' ||
+            download.status === 'paused' ||
+            download.status === 'cancelled') {
             refreshDownloads();
         }
     } else {
@@ -364,6 +589,19 @@ function updateDownloadItem(download) {
 }
 
 function getStatusText(download) {
+    if (download.queue_position) {
+        return `Queued (#${download.queue_position})`;
+    }
+
+    let text = statusLabel(download);
+    if (download.next_retry_at) {
+        const at = new Date(download.next_retry_at);
+        text += ` · Retrying at ${at.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}`;
+    }
+    return text;
+}
+
+function statusLabel(download) {
     switch (download.status) {
         case 'pending':
             return 'Processing magnet...';
@@ -383,6 +621,12 @@ function getStatusText(download) {
             return text;
         case 'error':
             return download.error_message || 'Error';
+        case 'partial':
+            return `Partially complete · ${download.error_message}`;
+        case 'paused':
+            return `Paused (${download.progress.toFixed(1)}%)`;
+        case 'cancelled':
+            return 'Cancelled';
         default:
             return download.status;
     }